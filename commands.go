@@ -0,0 +1,91 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+    "village_site/config"
+    "village_site/handlers"
+)
+
+// runCommand runs a maintenance command given on the command line instead of
+// starting the server
+func runCommand(args []string) error {
+    switch args[0] {
+    case "validate-json":
+        fs := flag.NewFlagSet("validate-json", flag.ExitOnError)
+        fix := fs.Bool("fix", false, "write corrected rivers values back")
+        state := fs.String("state", "", "only scan villages of this state")
+        maxIssues := fs.Int("max-issues", 200, "maximum issues listed in the report")
+        fs.Parse(args[1:])
+
+        report, err := handlers.ValidateVillageJSON(context.Background(), handlers.JSONValidationOptions{
+            State:     *state,
+            Fix:       *fix,
+            MaxIssues: *maxIssues,
+        })
+        if report != nil {
+            encoder := json.NewEncoder(os.Stdout)
+            encoder.SetIndent("", "  ")
+            encoder.Encode(report)
+        }
+        return err
+
+    case "link-census":
+        start := time.Now()
+        if err := handlers.RefreshCensusLinks(context.Background()); err != nil {
+            return err
+        }
+        fmt.Printf("Census links refreshed in %s\n", time.Since(start))
+        return nil
+
+    case "migrate-facility-ids":
+        start := time.Now()
+        if err := config.MigrateFacilityIDs(context.Background()); err != nil {
+            return err
+        }
+        fmt.Printf("Facility ids added in %s\n", time.Since(start))
+        return nil
+
+    case "import-representatives":
+        fs := flag.NewFlagSet("import-representatives", flag.ExitOnError)
+        file := fs.String("file", "", "CSV or JSON file of election results")
+        source := fs.String("source", "", "where the results come from (default the file name)")
+        dryRun := fs.Bool("dry-run", false, "report the outcome without writing")
+        fs.Parse(args[1:])
+        if *file == "" {
+            return fmt.Errorf("import-representatives needs -file")
+        }
+
+        f, err := os.Open(*file)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        format := "csv"
+        if strings.HasSuffix(strings.ToLower(*file), ".json") {
+            format = "json"
+        }
+        inputs, err := handlers.ParseRepresentativeTerms(f, format)
+        if err != nil {
+            return err
+        }
+        if *source == "" {
+            *source = filepath.Base(*file)
+        }
+
+        result, err := handlers.ImportRepresentativeTerms(context.Background(), inputs, *source, "cli", *dryRun)
+        if err != nil {
+            return err
+        }
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(result)
+    }
+    return fmt.Errorf("unknown command %q", args[0])
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+    "log"
     "os"
     "strconv"
+    "strings"
+    "time"
 )
 
 // Database configuration
@@ -50,4 +53,86 @@ func getEnvAsBool(key string, defaultValue bool) bool {
         }
     }
     return defaultValue
-} 
\ No newline at end of file
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+    if value := os.Getenv(key); value != "" {
+        if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+            return floatValue
+        }
+    }
+    return defaultValue
+}
+
+// GetEnvInt reads an integer from the environment
+func GetEnvInt(key string, defaultValue int) int {
+    return getEnvAsInt(key, defaultValue)
+}
+
+// GetEnvFloat reads a number from the environment
+func GetEnvFloat(key string, defaultValue float64) float64 {
+    return getEnvAsFloat(key, defaultValue)
+}
+
+// GetEnvDuration reads a duration such as "6h" or "30m" from the environment
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+    if value := os.Getenv(key); value != "" {
+        if d, err := time.ParseDuration(value); err == nil && d > 0 {
+            return d
+        }
+        log.Printf("Ignoring invalid duration %s=%q", key, value)
+    }
+    return defaultValue
+}
+
+// defaultInfrastructureWeights weights the village_census amenity flags that
+// make up the infrastructure index. Basic services (water, power, health,
+// primary schooling, road access) count more than conveniences.
+var defaultInfrastructureWeights = map[string]float64{
+    "treated_tap_water":     2,
+    "power_supply":          2,
+    "primary_health_center": 2,
+    "govt_primary_school":   2,
+    "district_road":         1.5,
+    "bus_service":           1.5,
+    "mobile_coverage":       1.5,
+    "drainage_system":       1,
+    "govt_secondary_school": 1,
+    "anganwadi":             1,
+    "commercial_bank":       1,
+    "medical_shop":          1,
+    "atm":                   0.5,
+    "garbage_collection":    0.5,
+    "internet_cafe":         0.5,
+}
+
+// InfrastructureIndexWeights returns the amenity weights of the census
+// infrastructure index. INFRA_INDEX_WEIGHTS replaces the defaults with a
+// comma separated list of column:weight pairs, e.g.
+// "treated_tap_water:2,power_supply:2,atm:0.5".
+func InfrastructureIndexWeights() map[string]float64 {
+    raw := os.Getenv("INFRA_INDEX_WEIGHTS")
+    if raw == "" {
+        weights := make(map[string]float64, len(defaultInfrastructureWeights))
+        for column, weight := range defaultInfrastructureWeights {
+            weights[column] = weight
+        }
+        return weights
+    }
+
+    weights := make(map[string]float64)
+    for _, pair := range strings.Split(raw, ",") {
+        parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+        if len(parts) != 2 {
+            log.Printf("Ignoring malformed INFRA_INDEX_WEIGHTS entry %q", pair)
+            continue
+        }
+        weight, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+        if err != nil || weight <= 0 {
+            log.Printf("Ignoring invalid INFRA_INDEX_WEIGHTS weight %q", pair)
+            continue
+        }
+        weights[strings.ToLower(strings.TrimSpace(parts[0]))] = weight
+    }
+    return weights
+}
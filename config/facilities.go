@@ -0,0 +1,94 @@
+package config
+
+import (
+    _ "embed"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "regexp"
+    "sync"
+    "village_site/models"
+)
+
+// defaultFacilityTypes is the built-in facility registry. FACILITY_TYPES_FILE
+// may point to a JSON file in the same format to replace it, so a new
+// category only needs a table and a registry entry.
+//
+//go:embed facility_types.json
+var defaultFacilityTypes []byte
+
+var (
+    facilityTypes     []models.FacilityType
+    facilityTypeIndex map[string]models.FacilityType
+    facilityTypesOnce sync.Once
+)
+
+var facilityTableName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+func parseFacilityTypes(data []byte) ([]models.FacilityType, error) {
+    var types []models.FacilityType
+    if err := json.Unmarshal(data, &types); err != nil {
+        return nil, err
+    }
+    seen := make(map[string]bool)
+    for i := range types {
+        t := &types[i]
+        if t.Table == "" {
+            t.Table = t.Key
+        }
+        if t.ResponseKey == "" {
+            t.ResponseKey = t.Key
+        }
+        if t.MandalKey == "" {
+            t.MandalKey = t.ResponseKey
+        }
+        if t.Key == "" || seen[t.Key] {
+            return nil, fmt.Errorf("facility type %d: missing or duplicate key %q", i, t.Key)
+        }
+        if !facilityTableName.MatchString(t.Table) {
+            return nil, fmt.Errorf("facility type %s: invalid table name %q", t.Key, t.Table)
+        }
+        seen[t.Key] = true
+    }
+    return types, nil
+}
+
+func loadFacilityTypes() {
+    types, err := parseFacilityTypes(defaultFacilityTypes)
+    if err != nil {
+        log.Fatalf("Invalid built-in facility types: %v", err)
+    }
+
+    if path := os.Getenv("FACILITY_TYPES_FILE"); path != "" {
+        data, err := os.ReadFile(path)
+        if err == nil {
+            var custom []models.FacilityType
+            if custom, err = parseFacilityTypes(data); err == nil {
+                types = custom
+            }
+        }
+        if err != nil {
+            log.Printf("Ignoring FACILITY_TYPES_FILE %s: %v", path, err)
+        }
+    }
+
+    facilityTypes = types
+    facilityTypeIndex = make(map[string]models.FacilityType, len(types))
+    for _, t := range types {
+        facilityTypeIndex[t.Key] = t
+    }
+}
+
+// FacilityTypes returns the registered facility types in registry order
+func FacilityTypes() []models.FacilityType {
+    facilityTypesOnce.Do(loadFacilityTypes)
+    return facilityTypes
+}
+
+// FindFacilityType looks up a facility type by key
+func FindFacilityType(key string) (models.FacilityType, bool) {
+    facilityTypesOnce.Do(loadFacilityTypes)
+    t, ok := facilityTypeIndex[key]
+    return t, ok
+}
@@ -0,0 +1,264 @@
+package config
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// schemaStatements create the tables the API maintains itself, on top of the
+// imported datasets. Every statement must be idempotent.
+var schemaStatements = []string{
+    // Per-district and per-state averages of the census indicators, rebuilt
+    // by the census aggregate job. area is the lowercased district or state.
+    `CREATE TABLE IF NOT EXISTS census_area_averages (
+        level        TEXT NOT NULL,
+        area         TEXT NOT NULL,
+        indicator    TEXT NOT NULL,
+        value        DOUBLE PRECISION NOT NULL,
+        villages     INTEGER NOT NULL,
+        refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        PRIMARY KEY (level, area, indicator)
+    )`,
+    // District rank of every village_census row for each ranking indicator,
+    // rebuilt by the census aggregate job. Names are lowercased and trimmed.
+    `CREATE TABLE IF NOT EXISTS village_census_ranks (
+        district    TEXT NOT NULL,
+        subdistrict TEXT NOT NULL,
+        village     TEXT NOT NULL,
+        indicator   TEXT NOT NULL,
+        value       DOUBLE PRECISION NOT NULL,
+        rank        INTEGER NOT NULL,
+        total       INTEGER NOT NULL,
+        percentile  DOUBLE PRECISION NOT NULL
+    )`,
+    `CREATE INDEX IF NOT EXISTS village_census_ranks_village_idx ON village_census_ranks (district, subdistrict, village)`,
+    // Phonetic keys of place and river names for native-script search,
+    // rebuilt by the search index job. alias holds a native-script river
+    // translation that maps exactly onto name.
+    `CREATE TABLE IF NOT EXISTS place_search_keys (
+        kind       TEXT NOT NULL,
+        name       TEXT NOT NULL,
+        search_key TEXT NOT NULL,
+        alias      TEXT
+    )`,
+    `CREATE INDEX IF NOT EXISTS place_search_keys_key_idx ON place_search_keys (search_key text_pattern_ops)`,
+    `CREATE INDEX IF NOT EXISTS place_search_keys_alias_idx ON place_search_keys (alias) WHERE alias IS NOT NULL`,
+    // Facility search checks that an "in <place>" names a known area
+    `CREATE INDEX IF NOT EXISTS place_search_keys_name_idx ON place_search_keys (LOWER(name))`,
+    // Link of each village (lowercased names) to its village_census row,
+    // maintained by the census link job. A NULL census_village means no
+    // match; method 'manual' marks an admin override the job keeps.
+    `CREATE TABLE IF NOT EXISTS village_census_links (
+        district           TEXT NOT NULL,
+        subdistrict        TEXT NOT NULL,
+        locality           TEXT NOT NULL,
+        census_district    TEXT,
+        census_subdistrict TEXT,
+        census_village     TEXT,
+        score              DOUBLE PRECISION NOT NULL DEFAULT 0,
+        method             TEXT NOT NULL,
+        candidates         JSONB,
+        reviewed_by        TEXT,
+        reviewed_at        TIMESTAMPTZ,
+        updated_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+        PRIMARY KEY (district, subdistrict, locality)
+    )`,
+    `CREATE INDEX IF NOT EXISTS village_census_links_score_idx ON village_census_links (score)`,
+    // Facility counts per type and subdistrict/district (lowercased names,
+    // state '' when unknown, subdistrict '' at district level) with the
+    // census population of the area, rebuilt by the facility summary job
+    `CREATE TABLE IF NOT EXISTS facility_summary (
+        level         TEXT NOT NULL,
+        state         TEXT NOT NULL DEFAULT '',
+        district      TEXT NOT NULL,
+        subdistrict   TEXT NOT NULL,
+        facility_type TEXT NOT NULL,
+        facilities    INTEGER NOT NULL,
+        population    BIGINT NOT NULL DEFAULT 0,
+        refreshed_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+        CONSTRAINT facility_summary_state_pkey PRIMARY KEY (level, state, district, subdistrict, facility_type)
+    )`,
+    // Summaries were once keyed without the state, merging same-named
+    // districts of different states; they are cleared and rebuilt by the job
+    `DO $$ BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'facility_summary_state_pkey') THEN
+            DELETE FROM facility_summary;
+            ALTER TABLE facility_summary DROP CONSTRAINT IF EXISTS facility_summary_pkey;
+            ALTER TABLE facility_summary ALTER COLUMN state SET DEFAULT '', ALTER COLUMN state SET NOT NULL;
+            ALTER TABLE facility_summary ADD CONSTRAINT facility_summary_state_pkey
+                PRIMARY KEY (level, state, district, subdistrict, facility_type);
+        END IF;
+    END $$`,
+    // Every change made to a facility through the API
+    `CREATE TABLE IF NOT EXISTS facility_audit_log (
+        id            BIGSERIAL PRIMARY KEY,
+        facility_type TEXT NOT NULL,
+        facility_id   BIGINT NOT NULL,
+        action        TEXT NOT NULL,
+        changed_by    TEXT NOT NULL,
+        changed_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+        source        TEXT NOT NULL,
+        before        JSONB,
+        after         JSONB
+    )`,
+    `CREATE INDEX IF NOT EXISTS facility_audit_log_facility_idx ON facility_audit_log (facility_type, facility_id)`,
+    // Elected representatives per constituency and term, loaded from
+    // election results. house is 'assembly' or 'lok_sabha'; constituency is
+    // lowercased, term_start is the year the term began.
+    `CREATE TABLE IF NOT EXISTS representative_terms (
+        house          TEXT NOT NULL,
+        constituency   TEXT NOT NULL,
+        state          TEXT NOT NULL DEFAULT '',
+        term_start     INTEGER NOT NULL,
+        term           TEXT NOT NULL,
+        name           TEXT NOT NULL,
+        representative TEXT NOT NULL,
+        party          TEXT NOT NULL DEFAULT '',
+        source         TEXT NOT NULL,
+        imported_by    TEXT NOT NULL,
+        imported_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+        PRIMARY KEY (house, constituency, state, term_start)
+    )`,
+    // Tourist places of every mandal, rebuilt by the tourist places job.
+    // latitude and longitude are the mandal's; months are the best months to
+    // visit, read from best_time.
+    `CREATE TABLE IF NOT EXISTS tourist_places (
+        id           BIGSERIAL PRIMARY KEY,
+        district     TEXT NOT NULL,
+        subdistrict  TEXT NOT NULL,
+        name         TEXT NOT NULL,
+        search_key   TEXT NOT NULL,
+        type         TEXT NOT NULL DEFAULT '',
+        description  TEXT NOT NULL DEFAULT '',
+        activities   TEXT[] NOT NULL DEFAULT '{}',
+        best_time    TEXT NOT NULL DEFAULT '',
+        months       INTEGER[] NOT NULL DEFAULT '{}',
+        distance     DOUBLE PRECISION,
+        latitude     DOUBLE PRECISION,
+        longitude    DOUBLE PRECISION,
+        refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    )`,
+    `CREATE INDEX IF NOT EXISTS tourist_places_location_idx ON tourist_places (latitude, longitude)`,
+    // Companies of every mandal, rebuilt by the companies job. latitude and
+    // longitude are the mandal's; employees is NULL when not stated.
+    `CREATE TABLE IF NOT EXISTS companies (
+        id           BIGSERIAL PRIMARY KEY,
+        district     TEXT NOT NULL,
+        subdistrict  TEXT NOT NULL,
+        name         TEXT NOT NULL,
+        search_key   TEXT NOT NULL,
+        type         TEXT NOT NULL DEFAULT '',
+        industry     TEXT NOT NULL DEFAULT '',
+        employees    INTEGER,
+        established  TEXT NOT NULL DEFAULT '',
+        latitude     DOUBLE PRECISION,
+        longitude    DOUBLE PRECISION,
+        refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    )`,
+    `CREATE INDEX IF NOT EXISTS companies_location_idx ON companies (latitude, longitude)`,
+    `CREATE INDEX IF NOT EXISTS companies_district_idx ON companies (LOWER(district))`,
+    // The state of the mandal, taken from its villages ('' when unknown), so
+    // same-named districts of different states stay apart
+    `ALTER TABLE tourist_places ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT ''`,
+    `ALTER TABLE companies ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT ''`,
+    // Numeric coordinates of the villages and facilities drawn on the map,
+    // rebuilt by the tile points job. layer is "villages" or a facility type
+    // key.
+    `CREATE TABLE IF NOT EXISTS tile_points (
+        layer       TEXT NOT NULL,
+        lat         DOUBLE PRECISION NOT NULL,
+        lon         DOUBLE PRECISION NOT NULL,
+        name        TEXT NOT NULL DEFAULT '',
+        district    TEXT NOT NULL DEFAULT '',
+        subdistrict TEXT NOT NULL DEFAULT ''
+    )`,
+    `CREATE INDEX IF NOT EXISTS tile_points_location_idx ON tile_points (layer, lat, lon)`,
+    // The national_highways JSON of village points, read by mandal routes
+    `ALTER TABLE tile_points ADD COLUMN IF NOT EXISTS highways TEXT NOT NULL DEFAULT ''`,
+}
+
+// EnsureSchema creates any missing API-owned tables
+func EnsureSchema() error {
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+    defer cancel()
+
+    for _, stmt := range schemaStatements {
+        if _, err := DB.ExecContext(ctx, stmt); err != nil {
+            return fmt.Errorf("error applying schema statement: %v", err)
+        }
+    }
+    return nil
+}
+
+// existingFacilityTables returns the registered facility tables present in
+// the database
+func existingFacilityTables(ctx context.Context) ([]string, error) {
+    var tables []string
+    for _, t := range FacilityTypes() {
+        var exists bool
+        if err := DB.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, pq.QuoteIdentifier(t.Table)).Scan(&exists); err != nil {
+            return nil, fmt.Errorf("error checking facility table %s: %v", t.Table, err)
+        }
+        if exists {
+            tables = append(tables, t.Table)
+        }
+    }
+    return tables, nil
+}
+
+// MissingFacilityIDs returns the facility tables that have no id column yet.
+// Facilities can only be edited once MigrateFacilityIDs has added it.
+func MissingFacilityIDs(ctx context.Context) ([]string, error) {
+    tables, err := existingFacilityTables(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    var missing []string
+    for _, table := range tables {
+        var exists bool
+        err := DB.QueryRowContext(ctx, `
+            SELECT EXISTS (
+                SELECT 1 FROM information_schema.columns
+                WHERE table_schema = current_schema()
+                AND table_name = $1
+                AND column_name = 'id'
+            )`, table).Scan(&exists)
+        if err != nil {
+            return nil, fmt.Errorf("error checking facility table %s: %v", table, err)
+        }
+        if !exists {
+            missing = append(missing, table)
+        }
+    }
+    return missing, nil
+}
+
+// MigrateFacilityIDs gives every facility table a generated id column, so
+// single facilities can be updated and deleted. Adding the column rewrites
+// the table under an exclusive lock, so it is run once by hand with the
+// migrate-facility-ids command rather than at startup. Tables that do not
+// exist yet are skipped.
+func MigrateFacilityIDs(ctx context.Context) error {
+    tables, err := existingFacilityTables(ctx)
+    if err != nil {
+        return err
+    }
+
+    for _, name := range tables {
+        table := pq.QuoteIdentifier(name)
+        statements := []string{
+            fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS id BIGSERIAL`, table),
+            fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (id)`, pq.QuoteIdentifier(name+"_id_idx"), table),
+        }
+        for _, stmt := range statements {
+            if _, err := DB.ExecContext(ctx, stmt); err != nil {
+                return fmt.Errorf("error adding id to facility table %s: %v", name, err)
+            }
+        }
+    }
+    return nil
+}
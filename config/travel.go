@@ -0,0 +1,98 @@
+package config
+
+import (
+    "encoding/json"
+    "log"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// defaultTravelSpeeds are average road speeds in km/h per travel mode.
+// Trains are not estimated from speeds; see the mandal transit options.
+var defaultTravelSpeeds = map[string]float64{
+    "bus":   40,
+    "car":   50,
+    "bike":  45,
+    "auto":  35,
+}
+
+var (
+    travelSpeeds      map[string]float64
+    stateTravelSpeeds map[string]map[string]float64
+    travelSpeedsOnce  sync.Once
+)
+
+// loadTravelSpeeds reads TRAVEL_SPEEDS, a comma separated list of mode:km/h
+// pairs that override the defaults (e.g. "bus:35,auto:30"), and
+// TRAVEL_STATE_SPEEDS_FILE, a JSON object of per-state overrides such as
+// {"Kerala": {"bus": 30, "car": 40}}.
+func loadTravelSpeeds() {
+    travelSpeeds = make(map[string]float64, len(defaultTravelSpeeds))
+    for mode, speed := range defaultTravelSpeeds {
+        travelSpeeds[mode] = speed
+    }
+
+    if raw := os.Getenv("TRAVEL_SPEEDS"); raw != "" {
+        for _, pair := range strings.Split(raw, ",") {
+            parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+            if len(parts) != 2 {
+                log.Printf("Ignoring malformed TRAVEL_SPEEDS entry %q", pair)
+                continue
+            }
+            speed, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+            if err != nil || speed <= 0 {
+                log.Printf("Ignoring invalid TRAVEL_SPEEDS speed %q", pair)
+                continue
+            }
+            travelSpeeds[strings.ToLower(strings.TrimSpace(parts[0]))] = speed
+        }
+    }
+
+    stateTravelSpeeds = make(map[string]map[string]float64)
+    if path := os.Getenv("TRAVEL_STATE_SPEEDS_FILE"); path != "" {
+        var overrides map[string]map[string]float64
+        data, err := os.ReadFile(path)
+        if err == nil {
+            err = json.Unmarshal(data, &overrides)
+        }
+        if err != nil {
+            log.Printf("Ignoring TRAVEL_STATE_SPEEDS_FILE %s: %v", path, err)
+            return
+        }
+        for state, speeds := range overrides {
+            modes := make(map[string]float64, len(speeds))
+            for mode, speed := range speeds {
+                if speed > 0 {
+                    modes[strings.ToLower(mode)] = speed
+                }
+            }
+            stateTravelSpeeds[strings.ToLower(strings.TrimSpace(state))] = modes
+        }
+    }
+}
+
+// TravelSpeeds returns the average speed in km/h of every travel mode, with
+// the overrides of the given state applied
+func TravelSpeeds(state string) map[string]float64 {
+    travelSpeedsOnce.Do(loadTravelSpeeds)
+    speeds := make(map[string]float64, len(travelSpeeds))
+    for mode, speed := range travelSpeeds {
+        speeds[mode] = speed
+    }
+    for mode, speed := range stateTravelSpeeds[strings.ToLower(strings.TrimSpace(state))] {
+        speeds[mode] = speed
+    }
+    return speeds
+}
+
+// RoadCircuityFactor is the ratio of road distance to straight-line
+// distance, ROAD_CIRCUITY_FACTOR (default 1.3)
+func RoadCircuityFactor() float64 {
+    factor := getEnvAsFloat("ROAD_CIRCUITY_FACTOR", 1.3)
+    if factor < 1 {
+        return 1
+    }
+    return factor
+}
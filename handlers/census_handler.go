@@ -5,6 +5,7 @@ import (
     "log"
     "net/http"
     "village_site/config"
+    "village_site/models"
 )
 
 type CensusRequest struct {
@@ -104,6 +105,9 @@ type CensusResponse struct {
         TotalArea      float64 `json:"total_area"`
         IrrigatedArea  float64 `json:"irrigated_area"`
     } `json:"area"`
+
+    Statistics  models.CensusIndicators  `json:"statistics"`
+    Comparisons models.CensusComparisons `json:"comparisons"`
 }
 
 func GetCensusDetails(w http.ResponseWriter, r *http.Request) {
@@ -116,6 +120,13 @@ func GetCensusDetails(w http.ResponseWriter, r *http.Request) {
     log.Printf("Received census request for: District=%s, Subdistrict=%s, Village=%s",
         req.District, req.Subdistrict, req.Village)
 
+    // Look the village up through its census link
+    census, linked := resolveCensusKey(req.District, req.Subdistrict, req.Village)
+    if !linked {
+        http.Error(w, "Census data not found", http.StatusNotFound)
+        return
+    }
+
     var response CensusResponse
     err := config.DB.QueryRow(`
         SELECT 
@@ -187,10 +198,10 @@ func GetCensusDetails(w http.ResponseWriter, r *http.Request) {
             COALESCE(NULLIF(trim(total_area::text), '')::float8, 0),
             COALESCE(NULLIF(trim(irrigated_area::text), '')::float8, 0)
         FROM village_census
-        WHERE LOWER(district) = LOWER($1)
-        AND LOWER(subdistrict) = LOWER($2)
-        AND LOWER(village) = LOWER($3)`,
-        req.District, req.Subdistrict, req.Village).Scan(
+        WHERE LOWER(trim(district)) = LOWER(trim($1))
+        AND LOWER(trim(subdistrict)) = LOWER(trim($2))
+        AND LOWER(trim(village)) = LOWER(trim($3))`,
+        census.District, census.Subdistrict, census.Village).Scan(
             &response.Basic.District,
             &response.Basic.Subdistrict,
             &response.Basic.Village,
@@ -266,6 +277,12 @@ func GetCensusDetails(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    response.Statistics, err = getCensusIndicators(response.Basic.District, response.Basic.Subdistrict, response.Basic.Village)
+    if err != nil {
+        log.Printf("Error computing census statistics: %v", err)
+    }
+    response.Comparisons = getCensusComparisons(response.Basic.District, "")
+
     // Set response headers
     w.Header().Set("Content-Type", "application/json")
     w.Header().Set("Cache-Control", "public, max-age=300") // Cache for 5 minutes
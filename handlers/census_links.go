@@ -0,0 +1,563 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "village_site/config"
+    "village_site/middleware"
+    "village_site/utils"
+
+    "github.com/lib/pq"
+)
+
+const (
+    // censusLinkMinScore is the lowest score stored as a link; weaker
+    // matches are kept as candidates for review only
+    censusLinkMinScore = 0.6
+    // censusAreaMinSimilarity is the lowest similarity at which a census
+    // district or subdistrict is taken to be the same as the village's
+    censusAreaMinSimilarity = 0.75
+    // censusDistrictFallbackPenalty scales matches found elsewhere in the
+    // district because the village's subdistrict had none
+    censusDistrictFallbackPenalty = 0.9
+    censusLinkCandidates          = 3
+    // censusCandidateMinScore is the lowest possible score of a candidate
+    // still offered for review
+    censusCandidateMinScore = 0.5
+)
+
+// censusKey identifies a village_census row by its lowercased names
+type censusKey struct {
+    District    string `json:"district"`
+    Subdistrict string `json:"subdistrict"`
+    Village     string `json:"village"`
+}
+
+type censusCandidate struct {
+    censusKey
+    Score float64 `json:"score"`
+}
+
+type censusName struct {
+    key        censusKey
+    normalized string
+    phonetic   string
+}
+
+func newCensusName(key censusKey, name string) censusName {
+    return censusName{key: key, normalized: utils.NormalizePlaceName(name), phonetic: utils.PhoneticKey(name)}
+}
+
+type censusSubdistrict struct {
+    name     censusName
+    villages []censusName
+}
+
+type censusDistrict struct {
+    name         censusName
+    subdistricts map[string]*censusSubdistrict
+    villages     []censusName
+}
+
+// censusIndex holds every village_census name, grouped by normalized
+// district and subdistrict
+type censusIndex struct {
+    districts map[string]*censusDistrict
+    exact     map[censusKey]bool
+
+    districtMatches    map[string]districtMatch
+    subdistrictMatches map[string]subdistrictMatch
+}
+
+func loadCensusIndex(ctx context.Context) (*censusIndex, error) {
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT DISTINCT LOWER(trim(district)), LOWER(trim(subdistrict)), LOWER(trim(village))
+        FROM village_census
+        WHERE NULLIF(trim(village), '') IS NOT NULL
+        AND NULLIF(trim(district), '') IS NOT NULL AND NULLIF(trim(subdistrict), '') IS NOT NULL`)
+    if err != nil {
+        return nil, fmt.Errorf("error reading census villages: %v", err)
+    }
+    defer rows.Close()
+
+    index := &censusIndex{
+        districts:          make(map[string]*censusDistrict),
+        exact:              make(map[censusKey]bool),
+        districtMatches:    make(map[string]districtMatch),
+        subdistrictMatches: make(map[string]subdistrictMatch),
+    }
+    for rows.Next() {
+        var key censusKey
+        if err := rows.Scan(&key.District, &key.Subdistrict, &key.Village); err != nil {
+            return nil, fmt.Errorf("error reading census villages: %v", err)
+        }
+        index.exact[key] = true
+
+        districtName := newCensusName(censusKey{District: key.District}, key.District)
+        district := index.districts[districtName.normalized]
+        if district == nil {
+            district = &censusDistrict{name: districtName, subdistricts: make(map[string]*censusSubdistrict)}
+            index.districts[districtName.normalized] = district
+        }
+
+        subdistrictName := newCensusName(censusKey{District: key.District, Subdistrict: key.Subdistrict}, key.Subdistrict)
+        subdistrict := district.subdistricts[subdistrictName.normalized]
+        if subdistrict == nil {
+            subdistrict = &censusSubdistrict{name: subdistrictName}
+            district.subdistricts[subdistrictName.normalized] = subdistrict
+        }
+
+        village := newCensusName(key, key.Village)
+        subdistrict.villages = append(subdistrict.villages, village)
+        district.villages = append(district.villages, village)
+    }
+    return index, rows.Err()
+}
+
+// nameScore compares two names: 1 for equal normalized names, 0.9 for equal
+// phonetic keys, otherwise their edit similarity
+func nameScore(a, b censusName) (float64, string) {
+    switch {
+    case a.normalized == b.normalized:
+        return 1, "normalized"
+    case a.phonetic != "" && a.phonetic == b.phonetic:
+        return 0.9, "phonetic"
+    }
+    return utils.Similarity(a.normalized, b.normalized), "fuzzy"
+}
+
+// bestArea picks the area whose name matches best, if any is similar enough
+func bestArea(name censusName, areas []censusName) (int, float64) {
+    best, bestScore := -1, 0.0
+    for i, area := range areas {
+        if score, _ := nameScore(name, area); score > bestScore {
+            best, bestScore = i, score
+        }
+    }
+    if bestScore < censusAreaMinSimilarity {
+        return -1, 0
+    }
+    return best, bestScore
+}
+
+type districtMatch struct {
+    district *censusDistrict
+    score    float64
+}
+
+type subdistrictMatch struct {
+    subdistrict *censusSubdistrict
+    score       float64
+}
+
+// matchDistrict finds the census district for a village district name.
+// Results are memoized, as every village of a district asks the same.
+func (index *censusIndex) matchDistrict(name string) districtMatch {
+    if match, ok := index.districtMatches[name]; ok {
+        return match
+    }
+    var match districtMatch
+    target := newCensusName(censusKey{}, name)
+    if district, ok := index.districts[target.normalized]; ok {
+        match = districtMatch{district, 1}
+    } else {
+        var districts []*censusDistrict
+        var names []censusName
+        for _, district := range index.districts {
+            districts = append(districts, district)
+            names = append(names, district.name)
+        }
+        if i, score := bestArea(target, names); i >= 0 {
+            match = districtMatch{districts[i], score}
+        }
+    }
+    index.districtMatches[name] = match
+    return match
+}
+
+func (index *censusIndex) matchSubdistrict(district *censusDistrict, name string) subdistrictMatch {
+    memoKey := district.name.key.District + "|" + name
+    if match, ok := index.subdistrictMatches[memoKey]; ok {
+        return match
+    }
+    var match subdistrictMatch
+    target := newCensusName(censusKey{}, name)
+    if subdistrict, ok := district.subdistricts[target.normalized]; ok {
+        match = subdistrictMatch{subdistrict, 1}
+    } else {
+        var subdistricts []*censusSubdistrict
+        var names []censusName
+        for _, subdistrict := range district.subdistricts {
+            subdistricts = append(subdistricts, subdistrict)
+            names = append(names, subdistrict.name)
+        }
+        if i, score := bestArea(target, names); i >= 0 {
+            match = subdistrictMatch{subdistricts[i], score}
+        }
+    }
+    index.subdistrictMatches[memoKey] = match
+    return match
+}
+
+// rankCensusVillages scores the candidates against the village name, best
+// first
+func rankCensusVillages(name censusName, candidates []censusName, factor float64) ([]censusCandidate, map[censusKey]string) {
+    ranked := make([]censusCandidate, 0, len(candidates))
+    methods := make(map[censusKey]string, len(candidates))
+    nameLength := len([]rune(name.normalized))
+    for _, candidate := range candidates {
+        // Names of very different length cannot be similar enough to
+        // be worth a review, so skip the edit distance
+        candidateLength := len([]rune(candidate.normalized))
+        longest, shortest := max(nameLength, candidateLength), min(nameLength, candidateLength)
+        if longest > 0 && float64(shortest)/float64(longest)*factor < censusCandidateMinScore &&
+            name.phonetic != candidate.phonetic {
+            continue
+        }
+
+        score, method := nameScore(name, candidate)
+        ranked = append(ranked, censusCandidate{censusKey: candidate.key, Score: score * factor})
+        methods[candidate.key] = method
+    }
+    sort.Slice(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+    return ranked, methods
+}
+
+type censusLink struct {
+    village    censusKey
+    census     *censusKey
+    score      float64
+    method     string
+    candidates []censusCandidate
+}
+
+// linkVillage matches one village against the census index. District and
+// subdistrict are matched first, so a village is only compared with census
+// villages of the same area; if its subdistrict has no good match the rest
+// of the district is searched at a penalty.
+func (index *censusIndex) linkVillage(village censusKey) censusLink {
+    link := censusLink{village: village, method: "none"}
+
+    if index.exact[village] {
+        link.census, link.score, link.method = &village, 1, "exact"
+        return link
+    }
+
+    district := index.matchDistrict(village.District)
+    if district.district == nil {
+        return link
+    }
+
+    name := newCensusName(village, village.Village)
+    var ranked []censusCandidate
+    var methods map[censusKey]string
+
+    if subdistrict := index.matchSubdistrict(district.district, village.Subdistrict); subdistrict.subdistrict != nil {
+        ranked, methods = rankCensusVillages(name, subdistrict.subdistrict.villages, district.score*subdistrict.score)
+    }
+    if len(ranked) == 0 || ranked[0].Score < censusLinkMinScore {
+        ranked, methods = rankCensusVillages(name, district.district.villages, district.score*censusDistrictFallbackPenalty)
+    }
+    if len(ranked) == 0 {
+        return link
+    }
+
+    best := ranked[0]
+    // Two equally good candidates are a guess either way
+    if len(ranked) > 1 && ranked[1].Score == best.Score {
+        best.Score *= 0.9
+    }
+    if len(ranked) > censusLinkCandidates {
+        ranked = ranked[:censusLinkCandidates]
+    }
+    link.candidates = ranked
+
+    if best.Score >= censusLinkMinScore {
+        link.census = &best.censusKey
+        link.score = best.Score
+        link.method = methods[best.censusKey]
+    }
+    return link
+}
+
+// RefreshCensusLinks matches every village to its village_census row and
+// stores the result in village_census_links. Links set by hand (method
+// "manual") are left alone, and rows without a district or subdistrict on
+// either side are skipped.
+func RefreshCensusLinks(ctx context.Context) error {
+    index, err := loadCensusIndex(ctx)
+    if err != nil {
+        return err
+    }
+
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT DISTINCT LOWER(trim(district)), LOWER(trim(subdistrict)), LOWER(trim(locality))
+        FROM villages
+        WHERE NULLIF(trim(locality), '') IS NOT NULL
+        AND NULLIF(trim(district), '') IS NOT NULL AND NULLIF(trim(subdistrict), '') IS NOT NULL`)
+    if err != nil {
+        return fmt.Errorf("error reading villages: %v", err)
+    }
+    var links []censusLink
+    for rows.Next() {
+        var village censusKey
+        if err := rows.Scan(&village.District, &village.Subdistrict, &village.Village); err != nil {
+            rows.Close()
+            return fmt.Errorf("error reading villages: %v", err)
+        }
+        links = append(links, index.linkVillage(village))
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error reading villages: %v", err)
+    }
+
+    return config.WithTransaction(ctx, func(tx *sql.Tx) error {
+        if _, err := tx.ExecContext(ctx, `
+            CREATE TEMP TABLE census_links_staging (LIKE village_census_links INCLUDING DEFAULTS) ON COMMIT DROP`); err != nil {
+            return fmt.Errorf("error creating staging table: %v", err)
+        }
+
+        stmt, err := tx.PrepareContext(ctx, pq.CopyIn("census_links_staging",
+            "district", "subdistrict", "locality", "census_district", "census_subdistrict", "census_village",
+            "score", "method", "candidates"))
+        if err != nil {
+            return fmt.Errorf("error preparing census link copy: %v", err)
+        }
+        for _, link := range links {
+            var censusDistrict, censusSubdistrict, censusVillage interface{}
+            if link.census != nil {
+                censusDistrict, censusSubdistrict, censusVillage = link.census.District, link.census.Subdistrict, link.census.Village
+            }
+            candidates, _ := json.Marshal(link.candidates)
+            if _, err := stmt.ExecContext(ctx, link.village.District, link.village.Subdistrict, link.village.Village,
+                censusDistrict, censusSubdistrict, censusVillage, link.score, link.method, string(candidates)); err != nil {
+                stmt.Close()
+                return fmt.Errorf("error copying census links: %v", err)
+            }
+        }
+        if _, err := stmt.ExecContext(ctx); err != nil {
+            stmt.Close()
+            return fmt.Errorf("error copying census links: %v", err)
+        }
+        if err := stmt.Close(); err != nil {
+            return fmt.Errorf("error copying census links: %v", err)
+        }
+
+        if _, err := tx.ExecContext(ctx, `
+            INSERT INTO village_census_links (
+                district, subdistrict, locality, census_district, census_subdistrict, census_village,
+                score, method, candidates, updated_at
+            )
+            SELECT district, subdistrict, locality, census_district, census_subdistrict, census_village,
+                score, method, candidates, now()
+            FROM census_links_staging
+            ON CONFLICT (district, subdistrict, locality) DO UPDATE SET
+                census_district = EXCLUDED.census_district,
+                census_subdistrict = EXCLUDED.census_subdistrict,
+                census_village = EXCLUDED.census_village,
+                score = EXCLUDED.score,
+                method = EXCLUDED.method,
+                candidates = EXCLUDED.candidates,
+                updated_at = now()
+            WHERE village_census_links.method <> 'manual'`); err != nil {
+            return fmt.Errorf("error storing census links: %v", err)
+        }
+
+        // Villages that no longer exist
+        if _, err := tx.ExecContext(ctx, `
+            DELETE FROM village_census_links l
+            WHERE l.method <> 'manual'
+            AND NOT EXISTS (
+                SELECT 1 FROM census_links_staging s
+                WHERE s.district = l.district AND s.subdistrict = l.subdistrict AND s.locality = l.locality
+            )`); err != nil {
+            return fmt.Errorf("error removing stale census links: %v", err)
+        }
+        return nil
+    })
+}
+
+// resolveCensusKey returns the village_census names linked to a village.
+// Villages the link job has not seen yet fall back to an exact name match;
+// ok is false when the village is known to have no census row.
+func resolveCensusKey(district, subdistrict, locality string) (key censusKey, ok bool) {
+    var censusDistrict, censusSubdistrict, censusVillage sql.NullString
+    err := config.DB.QueryRow(`
+        SELECT census_district, census_subdistrict, census_village
+        FROM village_census_links
+        WHERE district = LOWER(trim($1))
+        AND subdistrict = LOWER(trim($2))
+        AND locality = LOWER(trim($3))`,
+        district, subdistrict, locality).Scan(&censusDistrict, &censusSubdistrict, &censusVillage)
+
+    if err != nil {
+        if err != sql.ErrNoRows {
+            log.Printf("Error reading census link for %s/%s/%s: %v", district, subdistrict, locality, err)
+        }
+        return censusKey{District: district, Subdistrict: subdistrict, Village: locality}, true
+    }
+    if !censusVillage.Valid {
+        return censusKey{}, false
+    }
+    return censusKey{District: censusDistrict.String, Subdistrict: censusSubdistrict.String, Village: censusVillage.String}, true
+}
+
+type CensusLink struct {
+    District          string            `json:"district"`
+    Subdistrict       string            `json:"subdistrict"`
+    Locality          string            `json:"locality"`
+    CensusDistrict    *string           `json:"census_district"`
+    CensusSubdistrict *string           `json:"census_subdistrict"`
+    CensusVillage     *string           `json:"census_village"`
+    Score             float64           `json:"score"`
+    Method            string            `json:"method"`
+    Candidates        []censusCandidate `json:"candidates"`
+    ReviewedBy        *string           `json:"reviewed_by"`
+    ReviewedAt        *time.Time        `json:"reviewed_at"`
+}
+
+// GetCensusLinks lists links for review, weakest first. By default only
+// links scoring below max_score (0.9) are returned.
+func GetCensusLinks(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    maxScore := 0.9
+    if raw := q.Get("max_score"); raw != "" {
+        var err error
+        if maxScore, err = strconv.ParseFloat(raw, 64); err != nil {
+            http.Error(w, "max_score must be a number", http.StatusBadRequest)
+            return
+        }
+    }
+    page, _ := strconv.Atoi(q.Get("page"))
+    if page < 1 {
+        page = 1
+    }
+    limit, _ := strconv.Atoi(q.Get("limit"))
+    if limit < 1 || limit > 500 {
+        limit = 100
+    }
+
+    rows, err := config.DB.QueryContext(r.Context(), `
+        SELECT district, subdistrict, locality, census_district, census_subdistrict, census_village,
+            score, method, COALESCE(candidates::text, '[]'), reviewed_by, reviewed_at
+        FROM village_census_links
+        WHERE score < $1
+        AND ($2 = '' OR method = $2)
+        AND ($3 = '' OR district = LOWER(trim($3)))
+        ORDER BY score, district, subdistrict, locality
+        LIMIT $4 OFFSET $5`,
+        maxScore, q.Get("method"), q.Get("district"), limit, (page-1)*limit)
+    if err != nil {
+        log.Printf("Error listing census links: %v", err)
+        http.Error(w, "Error listing census links", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    links := make([]CensusLink, 0)
+    for rows.Next() {
+        var link CensusLink
+        var candidates string
+        if err := rows.Scan(&link.District, &link.Subdistrict, &link.Locality,
+            &link.CensusDistrict, &link.CensusSubdistrict, &link.CensusVillage,
+            &link.Score, &link.Method, &candidates, &link.ReviewedBy, &link.ReviewedAt); err != nil {
+            log.Printf("Error scanning census link: %v", err)
+            continue
+        }
+        json.Unmarshal([]byte(candidates), &link.Candidates)
+        links = append(links, link)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "links": links,
+        "page":  page,
+        "limit": limit,
+    })
+}
+
+// UpdateCensusLink overrides the link of one village. A null census_village
+// records that the village has no census row. Overrides are kept by later
+// runs of the link job.
+func UpdateCensusLink(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        District          string  `json:"district"`
+        Subdistrict       string  `json:"subdistrict"`
+        Locality          string  `json:"locality"`
+        CensusDistrict    string  `json:"census_district"`
+        CensusSubdistrict string  `json:"census_subdistrict"`
+        CensusVillage     *string `json:"census_village"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if strings.TrimSpace(req.District) == "" || strings.TrimSpace(req.Locality) == "" {
+        http.Error(w, "District and locality are required", http.StatusBadRequest)
+        return
+    }
+
+    var censusDistrict, censusSubdistrict, censusVillage interface{}
+    if req.CensusVillage != nil {
+        key := censusKey{
+            District:    strings.ToLower(strings.TrimSpace(req.CensusDistrict)),
+            Subdistrict: strings.ToLower(strings.TrimSpace(req.CensusSubdistrict)),
+            Village:     strings.ToLower(strings.TrimSpace(*req.CensusVillage)),
+        }
+        var exists bool
+        err := config.DB.QueryRowContext(r.Context(), `
+            SELECT EXISTS (
+                SELECT 1 FROM village_census
+                WHERE LOWER(trim(district)) = $1
+                AND LOWER(trim(subdistrict)) = $2
+                AND LOWER(trim(village)) = $3
+            )`, key.District, key.Subdistrict, key.Village).Scan(&exists)
+        if err != nil {
+            log.Printf("Error checking census village: %v", err)
+            http.Error(w, "Error updating census link", http.StatusInternalServerError)
+            return
+        }
+        if !exists {
+            http.Error(w, "Census village not found", http.StatusNotFound)
+            return
+        }
+        censusDistrict, censusSubdistrict, censusVillage = key.District, key.Subdistrict, key.Village
+    }
+
+    _, err := config.DB.ExecContext(r.Context(), `
+        INSERT INTO village_census_links (
+            district, subdistrict, locality, census_district, census_subdistrict, census_village,
+            score, method, reviewed_by, reviewed_at, updated_at
+        )
+        VALUES (LOWER(trim($1)), LOWER(trim($2)), LOWER(trim($3)), $4, $5, $6, 1, 'manual', $7, now(), now())
+        ON CONFLICT (district, subdistrict, locality) DO UPDATE SET
+            census_district = EXCLUDED.census_district,
+            census_subdistrict = EXCLUDED.census_subdistrict,
+            census_village = EXCLUDED.census_village,
+            score = 1,
+            method = 'manual',
+            reviewed_by = EXCLUDED.reviewed_by,
+            reviewed_at = now(),
+            updated_at = now()`,
+        req.District, req.Subdistrict, req.Locality,
+        censusDistrict, censusSubdistrict, censusVillage, middleware.AdminUser(r))
+    if err != nil {
+        log.Printf("Error updating census link: %v", err)
+        http.Error(w, "Error updating census link", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status": "updated",
+    })
+}
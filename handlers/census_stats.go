@@ -0,0 +1,221 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log"
+    "sort"
+    "strings"
+    "sync"
+    "village_site/config"
+    "village_site/models"
+)
+
+type censusStatistic struct {
+    Key     string // JSON name used in models.CensusIndicators and the averages maps
+    Expr    string
+    Missing bool // the census import lacks the columns; reported as null
+}
+
+var (
+    femaleWorkersOnce   sync.Once
+    femaleWorkersColumn bool
+)
+
+// hasFemaleWorkersColumn reports whether village_census carries a
+// female_working_population column. The standard import does not, in which
+// case the female workforce rate is reported as null.
+func hasFemaleWorkersColumn() bool {
+    femaleWorkersOnce.Do(func() {
+        err := config.DB.QueryRow(`
+            SELECT EXISTS (
+                SELECT 1 FROM information_schema.columns
+                WHERE table_name = 'village_census'
+                AND column_name = 'female_working_population'
+            )`).Scan(&femaleWorkersColumn)
+        if err != nil {
+            log.Printf("Error checking for female_working_population column: %v", err)
+        }
+    })
+    return femaleWorkersColumn
+}
+
+// infrastructureIndexExpr builds the infrastructure index: the weighted share,
+// from 0 to 100, of the configured amenity flags a village has. Weights come
+// from config.InfrastructureIndexWeights; unknown columns are ignored.
+func infrastructureIndexExpr() string {
+    known := make(map[string]bool, len(censusAmenityColumns))
+    for _, column := range censusAmenityColumns {
+        known[column] = true
+    }
+
+    weights := config.InfrastructureIndexWeights()
+    columns := make([]string, 0, len(weights))
+    for column := range weights {
+        if !known[column] {
+            log.Printf("Ignoring unknown infrastructure index column %q", column)
+            continue
+        }
+        columns = append(columns, column)
+    }
+    if len(columns) == 0 {
+        return "0::float8"
+    }
+    sort.Strings(columns)
+
+    var terms []string
+    var total float64
+    for _, column := range columns {
+        terms = append(terms, fmt.Sprintf("%g * (COALESCE(%s, 0) = 1)::int", weights[column], column))
+        total += weights[column]
+    }
+    return fmt.Sprintf("((%s) * 100.0 / %g)", strings.Join(terms, " + "), total)
+}
+
+func censusStatistics() []censusStatistic {
+    femaleWorkforce := censusStatistic{Key: "female_workforce_rate", Expr: "NULL::float8", Missing: true}
+    if hasFemaleWorkersColumn() {
+        femaleWorkforce = censusStatistic{Key: "female_workforce_rate", Expr: censusRate("female_working_population", "female_population")}
+    }
+
+    return []censusStatistic{
+        {Key: "literacy_rate", Expr: censusRate("total_literacy", "total_population")},
+        {Key: "workforce_rate", Expr: censusRate("working_population", "total_population")},
+        femaleWorkforce,
+        {Key: "infrastructure_index", Expr: infrastructureIndexExpr()},
+    }
+}
+
+// getCensusIndicators computes the derived statistics of one census village.
+// It returns sql.ErrNoRows when the village is not in village_census.
+// Statistics the import has no columns for are left nil.
+func getCensusIndicators(district, subdistrict, village string) (models.CensusIndicators, error) {
+    stats := censusStatistics()
+    exprs := make([]string, len(stats))
+    for i, stat := range stats {
+        if stat.Missing {
+            exprs[i] = stat.Expr
+            continue
+        }
+        exprs[i] = fmt.Sprintf("COALESCE(ROUND((%s)::numeric, 2)::float8, 0)", stat.Expr)
+    }
+
+    query := fmt.Sprintf(`
+        SELECT %s
+        FROM village_census
+        WHERE LOWER(trim(district)) = LOWER(trim($1))
+        AND LOWER(trim(subdistrict)) = LOWER(trim($2))
+        AND LOWER(trim(village)) = LOWER(trim($3))
+        LIMIT 1`, strings.Join(exprs, ", "))
+
+    var indicators models.CensusIndicators
+    var femaleWorkforce sql.NullFloat64
+    err := config.DB.QueryRow(query, district, subdistrict, village).Scan(
+        &indicators.LiteracyRate,
+        &indicators.WorkForceRate,
+        &femaleWorkforce,
+        &indicators.InfrastructureIndex,
+    )
+    if femaleWorkforce.Valid {
+        indicators.FemaleWorkForceRate = &femaleWorkforce.Float64
+    }
+    return indicators, err
+}
+
+// getCensusComparisons reads the precomputed district and state averages for
+// a census district. Without a state, it is taken from the villages table
+// when the district name belongs to only one state.
+func getCensusComparisons(district, state string) models.CensusComparisons {
+    comparisons := models.CensusComparisons{
+        DistrictAvg: map[string]float64{},
+        StateAvg:    map[string]float64{},
+    }
+
+    rows, err := config.DB.Query(`
+        SELECT a.level, a.indicator, ROUND(a.value::numeric, 2)::float8
+        FROM census_area_averages a
+        WHERE (a.level = 'district' AND a.area = LOWER($1))
+        OR (a.level = 'state' AND a.area = COALESCE(NULLIF(LOWER(trim($2)), ''), (
+            SELECT MIN(LOWER(trim(state))) FROM villages
+            WHERE LOWER(trim(district)) = LOWER(trim($1)) AND NULLIF(trim(state), '') IS NOT NULL
+            HAVING COUNT(DISTINCT LOWER(trim(state))) = 1
+        )))`, district, state)
+    if err != nil {
+        log.Printf("Error fetching census averages for %s: %v", district, err)
+        return comparisons
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var level, indicator string
+        var value float64
+        if err := rows.Scan(&level, &indicator, &value); err != nil {
+            log.Printf("Error scanning census average: %v", err)
+            continue
+        }
+        if level == "district" {
+            comparisons.DistrictAvg[indicator] = value
+        } else {
+            comparisons.StateAvg[indicator] = value
+        }
+    }
+
+    return comparisons
+}
+
+// RefreshCensusAggregates rebuilds census_area_averages: the mean of each
+// census statistic over the villages of every district and state. Villages
+// whose statistic is undefined (e.g. zero population) are left out of the
+// mean. village_census has no state column, so subdistricts are mapped to
+// states through the villages table; one whose name occurs in more than one
+// state is left out of the state averages. The district rank of every village
+// by each ranking indicator is rebuilt into village_census_ranks alongside.
+func RefreshCensusAggregates(ctx context.Context) error {
+    var selects []string
+    for _, stat := range censusStatistics() {
+        selects = append(selects, fmt.Sprintf(`
+            SELECT 'district', LOWER(c.district), '%[1]s', AVG(%[2]s), COUNT(%[2]s)
+            FROM village_census c
+            GROUP BY LOWER(c.district)
+            HAVING COUNT(%[2]s) > 0
+            UNION ALL
+            SELECT 'state', s.state, '%[1]s', AVG(%[2]s), COUNT(%[2]s)
+            FROM village_census c
+            JOIN area_states s
+                ON s.district = LOWER(trim(c.district)) AND s.subdistrict = LOWER(trim(c.subdistrict))
+            GROUP BY s.state
+            HAVING COUNT(%[2]s) > 0`, stat.Key, stat.Expr))
+    }
+
+    insert := `
+        WITH area_states AS (
+            SELECT LOWER(trim(district)) AS district, LOWER(trim(subdistrict)) AS subdistrict,
+                MIN(LOWER(trim(state))) AS state
+            FROM villages
+            WHERE NULLIF(trim(state), '') IS NOT NULL
+            GROUP BY 1, 2
+            HAVING COUNT(DISTINCT LOWER(trim(state))) = 1
+        )
+        INSERT INTO census_area_averages (level, area, indicator, value, villages)
+        ` + strings.Join(selects, "\n            UNION ALL")
+
+    return config.WithTransaction(ctx, func(tx *sql.Tx) error {
+        if _, err := tx.ExecContext(ctx, `DELETE FROM census_area_averages`); err != nil {
+            return fmt.Errorf("error clearing census averages: %v", err)
+        }
+        if _, err := tx.ExecContext(ctx, insert); err != nil {
+            return fmt.Errorf("error computing census averages: %v", err)
+        }
+
+        if _, err := tx.ExecContext(ctx, `DELETE FROM village_census_ranks`); err != nil {
+            return fmt.Errorf("error clearing village ranks: %v", err)
+        }
+        for _, indicator := range rankingIndicators {
+            if _, err := tx.ExecContext(ctx, rankInsertQuery(indicator)); err != nil {
+                return fmt.Errorf("error ranking villages by %s: %v", indicator.Key, err)
+            }
+        }
+        return nil
+    })
+}
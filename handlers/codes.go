@@ -0,0 +1,218 @@
+package handlers
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "village_site/config"
+
+    "github.com/gorilla/mux"
+)
+
+var (
+    nonDigits = regexp.MustCompile(`[^0-9]`)
+    nonAlnum  = regexp.MustCompile(`[^A-Za-z0-9]`)
+    // rtoCode is a compacted RTO code: state letters, office number and,
+    // in full registration prefixes, a series, e.g. TS09EA
+    rtoCode = regexp.MustCompile(`^([A-Z]{2})0*([0-9]{1,3})[A-Z]*$`)
+)
+
+// normalizeSTDCode returns the comparison key of an STD code (its digits
+// without leading zeros) and its usual form with one leading zero, e.g.
+// "040", "40" and "0 40" all become "40" and "040"
+func normalizeSTDCode(code string) (key, display string, ok bool) {
+    if strings.IndexFunc(code, func(r rune) bool { return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' }) >= 0 {
+        return "", "", false
+    }
+    key = strings.TrimLeft(nonDigits.ReplaceAllString(code, ""), "0")
+    if len(key) < 2 || len(key) > 7 {
+        return "", "", false
+    }
+    return key, "0" + key, true
+}
+
+// normalizeRTOCode returns the comparison key of an RTO code (state letters
+// and office number without leading zeros) and its usual form, e.g.
+// "TS-01", "ts 1" and "TS01" all become "TS1" and "TS-01"
+func normalizeRTOCode(code string) (key, display string, ok bool) {
+    m := rtoCode.FindStringSubmatch(strings.ToUpper(nonAlnum.ReplaceAllString(code, "")))
+    if m == nil {
+        return "", "", false
+    }
+    number, _ := strconv.Atoi(m[2])
+    return m[1] + strconv.Itoa(number), fmt.Sprintf("%s-%02d", m[1], number), true
+}
+
+// stdKeySQL and rtoKeySQL turn one code of a mandals column into the key
+// built by normalizeSTDCode and normalizeRTOCode
+func stdKeySQL(code string) string {
+    return fmt.Sprintf(`ltrim(regexp_replace(%s, '[^0-9]', '', 'g'), '0')`, code)
+}
+
+func rtoKeySQL(code string) string {
+    return fmt.Sprintf(`regexp_replace(upper(regexp_replace(%s, '[^A-Za-z0-9]', '', 'g')), '^([A-Z]{2})0*([0-9]{1,3})[A-Z]*$', '\1\2')`, code)
+}
+
+// codeKind is a code kept in a mandals column. A column may hold several
+// codes separated by commas, semicolons or slashes.
+type codeKind struct {
+    Column    string
+    KeySQL    func(string) string
+    Normalize func(string) (string, string, bool)
+}
+
+var codeKinds = map[string]codeKind{
+    "std": {"telephone_std_code", stdKeySQL, normalizeSTDCode},
+    "rto": {"vehicle_registration", rtoKeySQL, normalizeRTOCode},
+}
+
+// splitCodes normalizes every code of a column value, skipping those that
+// do not parse
+func (k codeKind) splitCodes(value string) []string {
+    codes := make([]string, 0)
+    for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' || r == '/' }) {
+        if _, display, ok := k.Normalize(part); ok {
+            codes = append(codes, display)
+        }
+    }
+    return codes
+}
+
+// GetCodeAreas returns the mandals, grouped by district, that use an STD
+// code (kind std) or RTO code (kind rto). Codes are matched however they
+// are written, e.g. "040" and "40", or "TS-01", "TS 01" and "ts1".
+func GetCodeAreas(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    kind, ok := codeKinds[vars["kind"]]
+    if !ok {
+        http.Error(w, "Code kind must be std or rto", http.StatusNotFound)
+        return
+    }
+    key, display, ok := kind.Normalize(vars["code"])
+    if !ok {
+        http.Error(w, "Invalid code", http.StatusBadRequest)
+        return
+    }
+
+    rows, err := config.DB.QueryContext(r.Context(), fmt.Sprintf(`
+        SELECT district, subdistrict, COALESCE(rto_office, '')
+        FROM mandals
+        WHERE EXISTS (
+            SELECT 1 FROM regexp_split_to_table(COALESCE(%s, ''), '[,;/]') AS code
+            WHERE %s = $1
+        )
+        ORDER BY district, subdistrict`, kind.Column, kind.KeySQL("code")), key)
+    if err != nil {
+        log.Printf("Error looking up %s code %s: %v", vars["kind"], display, err)
+        http.Error(w, "Error looking up code", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    type codeMandal struct {
+        Subdistrict string `json:"subdistrict"`
+        RTOOffice   string `json:"rto_office,omitempty"`
+    }
+    type codeDistrict struct {
+        District string       `json:"district"`
+        Mandals  []codeMandal `json:"mandals"`
+    }
+    districts := make([]codeDistrict, 0)
+    index := make(map[string]int)
+    total := 0
+    for rows.Next() {
+        var district string
+        var m codeMandal
+        if err := rows.Scan(&district, &m.Subdistrict, &m.RTOOffice); err != nil {
+            log.Printf("Error scanning code mandal: %v", err)
+            continue
+        }
+        if vars["kind"] != "rto" {
+            m.RTOOffice = ""
+        }
+        i, ok := index[strings.ToLower(district)]
+        if !ok {
+            i = len(districts)
+            index[strings.ToLower(district)] = i
+            districts = append(districts, codeDistrict{District: district})
+        }
+        districts[i].Mandals = append(districts[i].Mandals, m)
+        total++
+    }
+    if total == 0 {
+        http.Error(w, "No mandals use this code", http.StatusNotFound)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "kind":      vars["kind"],
+        "code":      display,
+        "mandals":   total,
+        "districts": districts,
+    })
+}
+
+// GetAreaCodes returns the STD and RTO codes of a mandal, or of a village
+// given with village, which uses its mandal's codes
+func GetAreaCodes(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    district, subdistrict, village := q.Get("district"), q.Get("subdistrict"), q.Get("village")
+    if district == "" || subdistrict == "" {
+        http.Error(w, "District and subdistrict are required", http.StatusBadRequest)
+        return
+    }
+
+    if village != "" {
+        err := config.DB.QueryRowContext(r.Context(), `
+            SELECT COALESCE(locality, village_name)
+            FROM villages
+            WHERE LOWER(district) = LOWER($1) AND LOWER(subdistrict) = LOWER($2)
+            AND (LOWER(locality) = LOWER($3) OR LOWER(village_name) = LOWER($3))
+            LIMIT 1`, district, subdistrict, village).Scan(&village)
+        if err == sql.ErrNoRows {
+            http.Error(w, "Village not found", http.StatusNotFound)
+            return
+        }
+        if err != nil {
+            log.Printf("Error fetching village: %v", err)
+            http.Error(w, "Error fetching codes", http.StatusInternalServerError)
+            return
+        }
+    }
+
+    var std, rto, rtoOffice string
+    err := config.DB.QueryRowContext(r.Context(), `
+        SELECT district, subdistrict, COALESCE(telephone_std_code, ''),
+            COALESCE(vehicle_registration, ''), COALESCE(rto_office, '')
+        FROM mandals
+        WHERE LOWER(district) = LOWER($1) AND LOWER(subdistrict) = LOWER($2)
+        LIMIT 1`, district, subdistrict).Scan(&district, &subdistrict, &std, &rto, &rtoOffice)
+    if err == sql.ErrNoRows {
+        http.Error(w, "Mandal not found", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        log.Printf("Error fetching mandal codes: %v", err)
+        http.Error(w, "Error fetching codes", http.StatusInternalServerError)
+        return
+    }
+
+    response := map[string]interface{}{
+        "district":    district,
+        "subdistrict": subdistrict,
+        "std_codes":   codeKinds["std"].splitCodes(std),
+        "rto_codes":   codeKinds["rto"].splitCodes(rto),
+        "rto_office":  rtoOffice,
+    }
+    if village != "" {
+        response["village"] = village
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(response)
+}
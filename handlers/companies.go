@@ -0,0 +1,289 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "village_site/config"
+    "village_site/models"
+    "village_site/utils"
+)
+
+const (
+    defaultEmployerRadiusKm = 50.0
+    maxEmployerRadiusKm     = 300.0
+    defaultCompanyLimit     = 20
+    maxCompanyLimit         = 200
+)
+
+// RefreshCompanies rebuilds companies from the companies JSON of every
+// mandal. Companies are located at their mandal.
+func RefreshCompanies(ctx context.Context) error {
+    return rebuildMandalList(ctx, mandalList{
+        Table:   "companies",
+        Label:   "companies",
+        Columns: []string{"type", "industry", "employees", "established"},
+        Decode:  decodeCompanies,
+    })
+}
+
+// decodeCompanies reads a mandal's companies JSON into the values of the
+// companies columns
+func decodeCompanies(raw string) ([]mandalListItem, error) {
+    var companies []models.Company
+    if err := decodeJSONColumn(raw, &companies); err != nil {
+        return nil, err
+    }
+    items := make([]mandalListItem, len(companies))
+    for i, company := range companies {
+        var employees interface{}
+        if company.Employees > 0 {
+            employees = int64(company.Employees)
+        }
+        items[i] = mandalListItem{company.Name, []interface{}{strings.TrimSpace(company.Type),
+            strings.TrimSpace(company.Industry), employees, strings.TrimSpace(company.Established)}}
+    }
+    return items, nil
+}
+
+// CompanyResult is an indexed company with the mandal it belongs to.
+// Latitude and longitude are the mandal's.
+type CompanyResult struct {
+    ID          int64    `json:"id"`
+    Name        string   `json:"name"`
+    Type        string   `json:"type"`
+    Industry    string   `json:"industry"`
+    Employees   *int     `json:"employees"`
+    Established string   `json:"established"`
+    State       string   `json:"state"`
+    District    string   `json:"district"`
+    Subdistrict string   `json:"subdistrict"`
+    Latitude    *float64 `json:"latitude"`
+    Longitude   *float64 `json:"longitude"`
+    Distance    *float64 `json:"distance,omitempty"`
+}
+
+const companyColumns = `c.id, c.name, c.type, c.industry, c.employees, c.established,
+            c.state, c.district, c.subdistrict, c.latitude, c.longitude`
+
+func scanCompany(rows *sql.Rows, extra ...interface{}) (CompanyResult, error) {
+    var c CompanyResult
+    var employees sql.NullInt64
+    var lat, lon sql.NullFloat64
+    dest := append([]interface{}{&c.ID, &c.Name, &c.Type, &c.Industry, &employees, &c.Established,
+        &c.State, &c.District, &c.Subdistrict, &lat, &lon}, extra...)
+    if err := rows.Scan(dest...); err != nil {
+        return c, err
+    }
+    if employees.Valid {
+        n := int(employees.Int64)
+        c.Employees = &n
+    }
+    if lat.Valid && lon.Valid {
+        c.Latitude, c.Longitude = &lat.Float64, &lon.Float64
+    }
+    return c, nil
+}
+
+// ListCompanies lists companies filtered by name (q), industry, type,
+// state, district and subdistrict. sort=employees (the default) puts the largest
+// employers first; sort=name orders alphabetically.
+func ListCompanies(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    order := "c.employees DESC NULLS LAST, c.name"
+    switch q.Get("sort") {
+    case "", "employees":
+    case "name":
+        order = "c.name, c.district"
+    default:
+        http.Error(w, "Sort must be employees or name", http.StatusBadRequest)
+        return
+    }
+    limit := listLimit(q.Get("limit"), defaultCompanyLimit, maxCompanyLimit)
+    offset, _ := strconv.Atoi(q.Get("offset"))
+    if offset < 0 {
+        offset = 0
+    }
+
+    rows, err := config.DB.QueryContext(r.Context(), fmt.Sprintf(`
+        SELECT %s, COUNT(*) OVER ()
+        FROM companies c
+        WHERE ($1 = '' OR c.search_key LIKE '%%' || $1 || '%%')
+        AND ($2 = '' OR LOWER(c.industry) LIKE '%%' || LOWER($2) || '%%')
+        AND ($3 = '' OR LOWER(c.type) = LOWER($3))
+        AND ($4 = '' OR LOWER(c.district) = LOWER($4))
+        AND ($5 = '' OR LOWER(c.subdistrict) = LOWER($5))
+        AND ($8 = '' OR LOWER(c.state) = LOWER($8))
+        ORDER BY %s
+        LIMIT $6 OFFSET $7`, companyColumns, order),
+        utils.NormalizePlaceName(q.Get("q")), likeEscaper.Replace(strings.TrimSpace(q.Get("industry"))), strings.TrimSpace(q.Get("type")),
+        strings.TrimSpace(q.Get("district")), strings.TrimSpace(q.Get("subdistrict")), limit, offset,
+        strings.TrimSpace(q.Get("state")))
+    if err != nil {
+        log.Printf("Error listing companies: %v", err)
+        http.Error(w, "Error listing companies", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    companies := make([]CompanyResult, 0)
+    total := 0
+    for rows.Next() {
+        company, err := scanCompany(rows, &total)
+        if err != nil {
+            log.Printf("Error scanning company: %v", err)
+            continue
+        }
+        companies = append(companies, company)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "companies": companies,
+        "total":     total,
+        "limit":     limit,
+        "offset":    offset,
+    })
+}
+
+// GetCompanyStats counts employers and their employees per district,
+// industry, or district and industry (group), optionally within a state,
+// district or industry. Districts are grouped with their state, as district
+// names recur across states. Industries are compared case-insensitively;
+// companies without one count as "Unknown".
+func GetCompanyStats(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    var keys []string
+    switch group := q.Get("group"); group {
+    case "", "district":
+        keys = []string{"state", "district"}
+    case "industry":
+        keys = []string{"industry"}
+    case "district,industry", "industry,district":
+        keys = []string{"state", "district", "industry"}
+    default:
+        http.Error(w, "Group must be district, industry or district,industry", http.StatusBadRequest)
+        return
+    }
+
+    expressions := map[string]string{
+        "state":    "MIN(c.state)",
+        "district": "MIN(c.district)",
+        "industry": "COALESCE(MIN(NULLIF(trim(c.industry), '')), 'Unknown')",
+    }
+    groupBy := map[string]string{
+        "state":    "LOWER(c.state)",
+        "district": "LOWER(c.district)",
+        "industry": "LOWER(trim(c.industry))",
+    }
+    selects := make([]string, len(keys))
+    groups := make([]string, len(keys))
+    for i, key := range keys {
+        selects[i] = expressions[key]
+        groups[i] = groupBy[key]
+    }
+
+    rows, err := config.DB.QueryContext(r.Context(), fmt.Sprintf(`
+        SELECT %s, COUNT(*), COALESCE(SUM(c.employees), 0), COUNT(c.employees)
+        FROM companies c
+        WHERE ($1 = '' OR LOWER(c.district) = LOWER($1))
+        AND ($2 = '' OR LOWER(c.industry) LIKE '%%' || LOWER($2) || '%%')
+        AND ($3 = '' OR LOWER(c.state) = LOWER($3))
+        GROUP BY %s
+        ORDER BY COALESCE(SUM(c.employees), 0) DESC, COUNT(*) DESC`,
+        strings.Join(selects, ", "), strings.Join(groups, ", ")),
+        strings.TrimSpace(q.Get("district")), likeEscaper.Replace(strings.TrimSpace(q.Get("industry"))),
+        strings.TrimSpace(q.Get("state")))
+    if err != nil {
+        log.Printf("Error computing company stats: %v", err)
+        http.Error(w, "Error computing company stats", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    stats := make([]map[string]interface{}, 0)
+    for rows.Next() {
+        values := make([]string, len(keys))
+        var employers, employees, reporting int64
+        dest := make([]interface{}, 0, len(keys)+3)
+        for i := range values {
+            dest = append(dest, &values[i])
+        }
+        if err := rows.Scan(append(dest, &employers, &employees, &reporting)...); err != nil {
+            log.Printf("Error scanning company stats: %v", err)
+            continue
+        }
+        entry := map[string]interface{}{
+            "employers": employers,
+            "employees": employees,
+            // employers_reporting is how many employers state a head count
+            "employers_reporting": reporting,
+        }
+        for i, key := range keys {
+            entry[key] = values[i]
+        }
+        stats = append(stats, entry)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "group": strings.TrimPrefix(strings.Join(keys, ","), "state,"),
+        "stats": stats,
+    })
+}
+
+// GetNearbyEmployers lists the largest employers within radius km (default
+// 50) of lat/lon or of a village given by district, subdistrict and village,
+// optionally in one industry. Companies of the same size are ordered by
+// distance.
+func GetNearbyEmployers(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    lat, lon, ok := requestPoint(w, r)
+    if !ok {
+        return
+    }
+
+    radius, ok := requestRadius(w, r, defaultEmployerRadiusKm, maxEmployerRadiusKm)
+    if !ok {
+        return
+    }
+    limit := listLimit(q.Get("limit"), defaultCompanyLimit, maxCompanyLimit)
+
+    rows, err := config.DB.QueryContext(r.Context(),
+        nearbyQuery("companies", "c", companyColumns,
+            "($7 = '' OR LOWER(c.industry) LIKE '%' || LOWER($7) || '%')", "employees DESC NULLS LAST, distance_km, name"),
+        append(nearbyArgs(lat, lon, radius, limit), likeEscaper.Replace(strings.TrimSpace(q.Get("industry"))))...)
+    if err != nil {
+        log.Printf("Error fetching nearby employers: %v", err)
+        http.Error(w, "Error fetching employers", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    companies := make([]CompanyResult, 0)
+    for rows.Next() {
+        var distance float64
+        company, err := scanCompany(rows, &distance)
+        if err != nil {
+            log.Printf("Error scanning company: %v", err)
+            continue
+        }
+        distance = math.Round(distance*100) / 100
+        company.Distance = &distance
+        companies = append(companies, company)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "latitude":  lat,
+        "longitude": lon,
+        "radius":    radius,
+        "companies": companies,
+    })
+}
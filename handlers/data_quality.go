@@ -0,0 +1,389 @@
+package handlers
+
+import (
+    "bufio"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+    "village_site/config"
+
+    "github.com/lib/pq"
+)
+
+// dataQualityChecks are the per-village checks, in report order
+var dataQualityChecks = []string{
+    "missing_coordinates",
+    "outside_india",
+    "outside_state",
+    "duplicate_locality",
+    "missing_census",
+}
+
+const dataQualityCacheDuration = time.Hour
+
+// indiaBounds is India's bounding box: min lat, max lat, min lon, max lon
+var indiaBounds = [4]float64{6.5, 37.5, 68.0, 97.5}
+
+// stateBounds are approximate bounding boxes of the states and union
+// territories, keyed by normalized name (see normalizeStateName). They only
+// catch gross errors such as swapped coordinates or a village filed under
+// the wrong state, so a small margin is added when checking.
+var stateBounds = map[string][4]float64{
+    "andaman and nicobar islands": {6.7, 13.7, 92.2, 94.3},
+    "andhra pradesh":              {12.6, 19.95, 76.75, 84.8},
+    "arunachal pradesh":           {26.6, 29.5, 91.5, 97.5},
+    "assam":                       {24.1, 28.0, 89.7, 96.1},
+    "bihar":                       {24.3, 27.55, 83.3, 88.3},
+    "chandigarh":                  {30.65, 30.8, 76.68, 76.85},
+    "chhattisgarh":                {17.75, 24.15, 80.2, 84.45},
+    "dadra and nagar haveli and daman and diu": {20.35, 20.8, 70.8, 73.25},
+    "delhi":             {28.4, 28.9, 76.8, 77.35},
+    "goa":               {14.85, 15.82, 73.65, 74.35},
+    "gujarat":           {20.1, 24.75, 68.1, 74.5},
+    "haryana":           {27.6, 30.95, 74.45, 77.6},
+    "himachal pradesh":  {30.35, 33.25, 75.55, 79.0},
+    "jammu and kashmir": {32.25, 35.0, 73.4, 76.8},
+    "jharkhand":         {21.95, 25.35, 83.3, 87.95},
+    "karnataka":         {11.55, 18.5, 74.0, 78.6},
+    "kerala":            {8.15, 12.8, 74.85, 77.45},
+    "ladakh":            {32.3, 36.0, 75.3, 80.3},
+    "lakshadweep":       {8.2, 12.4, 71.7, 74.0},
+    "madhya pradesh":    {21.05, 26.9, 74.0, 82.85},
+    "maharashtra":       {15.6, 22.05, 72.6, 80.9},
+    "manipur":           {23.8, 25.7, 93.0, 94.8},
+    "meghalaya":         {25.0, 26.15, 89.8, 92.85},
+    "mizoram":           {21.9, 24.55, 92.25, 93.45},
+    "nagaland":          {25.2, 27.05, 93.3, 95.25},
+    "odisha":            {17.8, 22.6, 81.35, 87.5},
+    "puducherry":        {10.8, 16.8, 75.5, 82.3},
+    "punjab":            {29.5, 32.55, 73.85, 76.95},
+    "rajasthan":         {23.05, 30.2, 69.45, 78.3},
+    "sikkim":            {27.05, 28.15, 88.0, 88.95},
+    "tamil nadu":        {8.05, 13.6, 76.2, 80.35},
+    "telangana":         {15.8, 19.95, 77.2, 81.35},
+    "tripura":           {22.9, 24.55, 91.15, 92.35},
+    "uttar pradesh":     {23.85, 30.45, 77.05, 84.65},
+    "uttarakhand":       {28.7, 31.5, 77.55, 81.05},
+    "west bengal":       {21.5, 27.25, 85.8, 89.9},
+}
+
+// stateAliases map older or alternative spellings to stateBounds keys
+var stateAliases = map[string]string{
+    "orissa":                 "odisha",
+    "uttaranchal":            "uttarakhand",
+    "pondicherry":            "puducherry",
+    "nct of delhi":           "delhi",
+    "dadra and nagar haveli": "dadra and nagar haveli and daman and diu",
+    "daman and diu":          "dadra and nagar haveli and daman and diu",
+}
+
+// stateBoundsMargin is the slack, in degrees, around each state box
+const stateBoundsMargin = 0.1
+
+// normalizeStateSQL is the SQL equivalent of normalizeStateName
+const normalizeStateSQL = `regexp_replace(replace(LOWER(trim(%s)), '&', 'and'), '\s+', ' ', 'g')`
+
+func normalizeStateName(state string) string {
+    state = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(state)), "&", "and")
+    return strings.Join(strings.Fields(state), " ")
+}
+
+// dataQualityQuery selects every village of the optional state ($1) and
+// district ($2) with one boolean column per check. State boxes are passed as
+// parallel arrays ($3-$7).
+func dataQualityQuery() string {
+    return fmt.Sprintf(`
+        WITH state_bounds AS (
+            SELECT * FROM unnest($3::text[], $4::float8[], $5::float8[], $6::float8[], $7::float8[])
+                AS b(state, min_lat, max_lat, min_lon, max_lon)
+        ),
+        v AS (
+            SELECT
+                COALESCE(state, '') AS state,
+                COALESCE(district, '') AS district,
+                COALESCE(subdistrict, '') AS subdistrict,
+                COALESCE(locality, '') AS locality,
+                NULLIF(trim(latitude::text), '')::float8 AS lat,
+                NULLIF(trim(longitude::text), '')::float8 AS lon
+            FROM villages
+            WHERE ($1 = '' OR LOWER(state) = LOWER($1))
+            AND ($2 = '' OR LOWER(district) = LOWER($2))
+        ),
+        checked AS (
+            SELECT
+                v.*,
+                (lat IS NULL OR lon IS NULL OR lat = 0 OR lon = 0) AS missing_coordinates,
+                (lat <> 0 AND lon <> 0 AND NOT (lat BETWEEN %[2]f AND %[3]f AND lon BETWEEN %[4]f AND %[5]f)) AS outside_india,
+                (lat <> 0 AND lon <> 0 AND b.state IS NOT NULL AND NOT (
+                    lat BETWEEN b.min_lat - %[6]f AND b.max_lat + %[6]f
+                    AND lon BETWEEN b.min_lon - %[6]f AND b.max_lon + %[6]f
+                )) AS outside_state,
+                (locality <> '' AND COUNT(*) OVER (
+                    PARTITION BY LOWER(v.state), LOWER(district), LOWER(subdistrict), LOWER(trim(locality))
+                ) > 1) AS duplicate_locality,
+                CASE WHEN l.method IS NOT NULL THEN l.census_village IS NULL
+                ELSE NOT EXISTS (
+                    SELECT 1 FROM village_census vc
+                    WHERE LOWER(vc.district) = LOWER(v.district)
+                    AND LOWER(vc.subdistrict) = LOWER(v.subdistrict)
+                    AND LOWER(vc.village) = LOWER(v.locality)
+                ) END AS missing_census
+            FROM v
+            LEFT JOIN state_bounds b ON b.state = %[1]s
+            LEFT JOIN village_census_links l
+                ON l.district = LOWER(trim(v.district))
+                AND l.subdistrict = LOWER(trim(v.subdistrict))
+                AND l.locality = LOWER(trim(v.locality))
+        )`,
+        fmt.Sprintf(normalizeStateSQL, "v.state"),
+        indiaBounds[0], indiaBounds[1], indiaBounds[2], indiaBounds[3],
+        stateBoundsMargin)
+}
+
+// dataQualityArgs returns the query arguments, expanding stateBounds with
+// its aliases
+func dataQualityArgs(state, district string) []interface{} {
+    var names []string
+    var minLat, maxLat, minLon, maxLon []float64
+    add := func(name string, b [4]float64) {
+        names = append(names, name)
+        minLat, maxLat = append(minLat, b[0]), append(maxLat, b[1])
+        minLon, maxLon = append(minLon, b[2]), append(maxLon, b[3])
+    }
+    for name, b := range stateBounds {
+        add(name, b)
+    }
+    for alias, name := range stateAliases {
+        add(alias, stateBounds[name])
+    }
+    return []interface{}{state, district, pq.Array(names),
+        pq.Array(minLat), pq.Array(maxLat), pq.Array(minLon), pq.Array(maxLon)}
+}
+
+type DataQualityArea struct {
+    Name     string         `json:"name"`
+    Villages int            `json:"villages"`
+    Checks   map[string]int `json:"checks"`
+}
+
+type DataQualityState struct {
+    DataQualityArea
+    BoundsKnown bool              `json:"bounds_known"`
+    Districts   []DataQualityArea `json:"districts"`
+}
+
+type DataQualityReport struct {
+    Villages    int                `json:"villages"`
+    Checks      map[string]int     `json:"checks"`
+    States      []DataQualityState `json:"states"`
+    GeneratedAt time.Time          `json:"generated_at"`
+}
+
+// GetDataQualityReport counts, per state and district, the villages failing
+// each data quality check. The scan is expensive, so reports are cached for
+// an hour unless refresh=true.
+func GetDataQualityReport(w http.ResponseWriter, r *http.Request) {
+    state := strings.TrimSpace(r.URL.Query().Get("state"))
+    cacheKey := config.GetCacheKey("data_quality", strings.ToLower(state))
+
+    if r.URL.Query().Get("refresh") != "true" {
+        if cached, found := config.VillageCache.Get(cacheKey); found {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(cached)
+            return
+        }
+    }
+
+    http.NewResponseController(w).SetWriteDeadline(time.Now().Add(10 * time.Minute))
+
+    var sums []string
+    for _, check := range dataQualityChecks {
+        sums = append(sums, fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", check))
+    }
+    query := dataQualityQuery() + `
+        SELECT state, district, COUNT(*), ` + strings.Join(sums, ", ") + `
+        FROM checked
+        GROUP BY state, district
+        ORDER BY state, district`
+
+    rows, err := config.DB.QueryContext(r.Context(), query, dataQualityArgs(state, "")...)
+    if err != nil {
+        log.Printf("Error computing data quality report: %v", err)
+        http.Error(w, "Error computing data quality report", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    report := DataQualityReport{
+        Checks:      newCheckCounts(),
+        States:      make([]DataQualityState, 0),
+        GeneratedAt: time.Now().UTC(),
+    }
+    var stateName, districtName string
+    var villages int
+    counts := make([]int, len(dataQualityChecks))
+    dest := []interface{}{&stateName, &districtName, &villages}
+    for i := range counts {
+        dest = append(dest, &counts[i])
+    }
+
+    for rows.Next() {
+        if err := rows.Scan(dest...); err != nil {
+            log.Printf("Error reading data quality report: %v", err)
+            http.Error(w, "Error computing data quality report", http.StatusInternalServerError)
+            return
+        }
+        if len(report.States) == 0 || report.States[len(report.States)-1].Name != stateName {
+            _, known := stateBounds[normalizeStateName(stateName)]
+            if !known {
+                _, known = stateAliases[normalizeStateName(stateName)]
+            }
+            report.States = append(report.States, DataQualityState{
+                DataQualityArea: DataQualityArea{Name: stateName, Checks: newCheckCounts()},
+                BoundsKnown:     known,
+                Districts:       make([]DataQualityArea, 0),
+            })
+        }
+        current := &report.States[len(report.States)-1]
+
+        district := DataQualityArea{Name: districtName, Villages: villages, Checks: newCheckCounts()}
+        for i, check := range dataQualityChecks {
+            district.Checks[check] = counts[i]
+            current.Checks[check] += counts[i]
+            report.Checks[check] += counts[i]
+        }
+        current.Villages += villages
+        report.Villages += villages
+        current.Districts = append(current.Districts, district)
+    }
+    if err := rows.Err(); err != nil {
+        log.Printf("Error computing data quality report: %v", err)
+        http.Error(w, "Error computing data quality report", http.StatusInternalServerError)
+        return
+    }
+
+    config.VillageCache.Set(cacheKey, report, dataQualityCacheDuration)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(report)
+}
+
+func newCheckCounts() map[string]int {
+    counts := make(map[string]int, len(dataQualityChecks))
+    for _, check := range dataQualityChecks {
+        counts[check] = 0
+    }
+    return counts
+}
+
+var dataQualityRowColumns = []string{"state", "district", "subdistrict", "locality", "latitude", "longitude"}
+
+// GetDataQualityRows downloads the villages failing one check as CSV or
+// NDJSON, optionally limited to a state and district
+func GetDataQualityRows(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    check := q.Get("check")
+    valid := false
+    for _, c := range dataQualityChecks {
+        valid = valid || c == check
+    }
+    if !valid {
+        http.Error(w, "check must be one of "+strings.Join(dataQualityChecks, ", "), http.StatusBadRequest)
+        return
+    }
+
+    format := strings.ToLower(q.Get("format"))
+    if format == "" {
+        format = "csv"
+    }
+    if format != "csv" && format != "ndjson" {
+        http.Error(w, "Format must be csv or ndjson", http.StatusBadRequest)
+        return
+    }
+
+    state := strings.TrimSpace(q.Get("state"))
+    district := strings.TrimSpace(q.Get("district"))
+
+    rc := http.NewResponseController(w)
+    rc.SetWriteDeadline(time.Now().Add(exportWriteWindow))
+
+    query := dataQualityQuery() + `
+        SELECT state, district, subdistrict, locality,
+            COALESCE(lat::text, ''), COALESCE(lon::text, '')
+        FROM checked
+        WHERE ` + check + `
+        ORDER BY state, district, subdistrict, locality`
+
+    rows, err := config.DB.QueryContext(r.Context(), query, dataQualityArgs(state, district)...)
+    if err != nil {
+        log.Printf("Error listing %s villages: %v", check, err)
+        http.Error(w, "Error listing villages", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    filename := check + strings.TrimPrefix(exportFilename(state, district, format, false), "villages")
+    if format == "csv" {
+        w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    } else {
+        w.Header().Set("Content-Type", "application/x-ndjson")
+    }
+    w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+    w.Header().Set("Cache-Control", "no-store")
+
+    buffered := bufio.NewWriterSize(w, 64*1024)
+    csvWriter := csv.NewWriter(buffered)
+    encoder := json.NewEncoder(buffered)
+    if format == "csv" {
+        csvWriter.Write(append(dataQualityRowColumns, "check"))
+    }
+
+    values := make([]string, len(dataQualityRowColumns))
+    dest := make([]interface{}, len(values))
+    for i := range values {
+        dest[i] = &values[i]
+    }
+
+    written := 0
+    for rows.Next() {
+        if err := rows.Scan(dest...); err != nil {
+            log.Printf("Error reading %s villages: %v", check, err)
+            break
+        }
+        if format == "csv" {
+            csvWriter.Write(append(values, check))
+        } else {
+            record := map[string]interface{}{"check": check}
+            for i, column := range dataQualityRowColumns {
+                record[column] = values[i]
+                if column == "latitude" || column == "longitude" {
+                    if f, err := strconv.ParseFloat(values[i], 64); err == nil {
+                        record[column] = f
+                    } else {
+                        record[column] = nil
+                    }
+                }
+            }
+            encoder.Encode(record)
+        }
+
+        written++
+        if written%exportFlushRows == 0 {
+            csvWriter.Flush()
+            buffered.Flush()
+            rc.Flush()
+            rc.SetWriteDeadline(time.Now().Add(exportWriteWindow))
+        }
+    }
+    if err := rows.Err(); err != nil {
+        log.Printf("Error listing %s villages: %v", check, err)
+    }
+
+    csvWriter.Flush()
+    buffered.Flush()
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+    "bufio"
+    "compress/gzip"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+    "village_site/config"
+)
+
+const (
+    // exportFlushRows is how many rows are written between flushes
+    exportFlushRows = 500
+    // exportWriteWindow is how long each flushed batch may take to reach the
+    // client. Exports outlive the server's WriteTimeout, so the deadline is
+    // pushed forward after every batch instead.
+    exportWriteWindow = 60 * time.Second
+)
+
+var exportColumns = []string{
+    "state", "district", "subdistrict", "locality", "village_name",
+    "latitude", "longitude", "pin_code", "parliament_mp", "assembly_mla",
+    "colleges_near", "schools_near", "national_highways", "rivers",
+}
+
+// exportErrorMarker starts the last row of a CSV export that failed part-way.
+// The row is "#export-error,export interrupted,<next offset>".
+const exportErrorMarker = "#export-error"
+
+// exportJSONColumns are written as nested JSON in NDJSON output
+var exportJSONColumns = map[string]bool{
+    "colleges_near":     true,
+    "schools_near":      true,
+    "national_highways": true,
+    "rivers":            true,
+}
+
+// ExportVillages streams the villages of a state or district as CSV or NDJSON
+// straight from the database cursor. Rows come in a stable order, so an
+// interrupted download resumes with offset set to the number of rows already
+// received.
+func ExportVillages(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    state := strings.TrimSpace(q.Get("state"))
+    district := strings.TrimSpace(q.Get("district"))
+    if state == "" && district == "" {
+        http.Error(w, "State or district is required", http.StatusBadRequest)
+        return
+    }
+
+    format := strings.ToLower(q.Get("format"))
+    if format == "" {
+        format = "csv"
+    }
+    if format != "csv" && format != "ndjson" {
+        http.Error(w, "Format must be csv or ndjson", http.StatusBadRequest)
+        return
+    }
+
+    offset := 0
+    if raw := q.Get("offset"); raw != "" {
+        var err error
+        if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+            http.Error(w, "Offset must be a non-negative integer", http.StatusBadRequest)
+            return
+        }
+    }
+    compress := strings.EqualFold(q.Get("compress"), "gzip")
+
+    rc := http.NewResponseController(w)
+    if err := rc.SetWriteDeadline(time.Now().Add(exportWriteWindow)); err != nil {
+        log.Printf("Export: unable to extend write deadline: %v", err)
+    }
+
+    rows, err := config.DB.QueryContext(r.Context(), `
+        SELECT
+            COALESCE(state, ''),
+            COALESCE(district, ''),
+            COALESCE(subdistrict, ''),
+            COALESCE(locality, ''),
+            COALESCE(village_name, ''),
+            COALESCE(NULLIF(trim(latitude::text), ''), ''),
+            COALESCE(NULLIF(trim(longitude::text), ''), ''),
+            COALESCE(pin_code::text, ''),
+            COALESCE(parliament_mp, ''),
+            COALESCE(assembly_mla, ''),
+            COALESCE(NULLIF(colleges_near::text, ''), '[]'),
+            COALESCE(NULLIF(schools_near::text, ''), '[]'),
+            COALESCE(NULLIF(national_highways::text, ''), '[]'),
+            COALESCE(NULLIF(rivers::text, ''), '[]')
+        FROM villages
+        WHERE ($1 = '' OR LOWER(state) = LOWER($1))
+        AND ($2 = '' OR LOWER(district) = LOWER($2))
+        ORDER BY state, district, subdistrict, locality, village_name, ctid
+        OFFSET $3`, state, district, offset)
+    if err != nil {
+        log.Printf("Export: error querying villages: %v", err)
+        http.Error(w, "Error exporting villages", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    filename := exportFilename(state, district, format, compress)
+    if compress {
+        w.Header().Set("Content-Type", "application/gzip")
+    } else if format == "csv" {
+        w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    } else {
+        w.Header().Set("Content-Type", "application/x-ndjson")
+    }
+    w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+    w.Header().Set("X-Export-Offset", strconv.Itoa(offset))
+    w.Header().Set("Cache-Control", "no-store")
+    w.Header().Set("Trailer", "X-Export-Status, X-Export-Next-Offset")
+
+    var out io.Writer = w
+    var gz *gzip.Writer
+    if compress {
+        gz = gzip.NewWriter(w)
+        defer gz.Close()
+        out = gz
+    }
+    buffered := bufio.NewWriterSize(out, 64*1024)
+
+    flush := func() {
+        buffered.Flush()
+        if gz != nil {
+            gz.Flush()
+        }
+        rc.Flush()
+        rc.SetWriteDeadline(time.Now().Add(exportWriteWindow))
+    }
+
+    var csvWriter *csv.Writer
+    encoder := json.NewEncoder(buffered)
+    if format == "csv" {
+        csvWriter = csv.NewWriter(buffered)
+        if offset == 0 {
+            csvWriter.Write(exportColumns)
+        }
+    }
+
+    values := make([]string, len(exportColumns))
+    dest := make([]interface{}, len(exportColumns))
+    for i := range values {
+        dest[i] = &values[i]
+    }
+
+    written := 0
+    var failure error
+    for rows.Next() {
+        if failure = rows.Scan(dest...); failure != nil {
+            break
+        }
+
+        if csvWriter != nil {
+            csvWriter.Write(values)
+        } else {
+            encoder.Encode(exportRecord(values))
+        }
+
+        written++
+        if written%exportFlushRows == 0 {
+            if csvWriter != nil {
+                csvWriter.Flush()
+            }
+            flush()
+            if r.Context().Err() != nil {
+                log.Printf("Export: client went away after %d rows", offset+written)
+                return
+            }
+        }
+    }
+
+    if failure == nil {
+        failure = rows.Err()
+    }
+    if failure != nil {
+        log.Printf("Export: interrupted after %d rows: %v", offset+written, failure)
+        if csvWriter != nil {
+            csvWriter.Write([]string{exportErrorMarker, "export interrupted", strconv.Itoa(offset + written)})
+        } else {
+            encoder.Encode(map[string]interface{}{
+                "error":       "export interrupted",
+                "next_offset": offset + written,
+            })
+        }
+        w.Header().Set("X-Export-Status", "interrupted")
+        w.Header().Set("X-Export-Next-Offset", strconv.Itoa(offset+written))
+    } else {
+        w.Header().Set("X-Export-Status", "complete")
+    }
+
+    if csvWriter != nil {
+        csvWriter.Flush()
+    }
+    flush()
+    if failure != nil {
+        return
+    }
+    log.Printf("Export: wrote %d villages (state=%q, district=%q, offset=%d)", written, state, district, offset)
+}
+
+func exportRecord(values []string) map[string]interface{} {
+    record := make(map[string]interface{}, len(exportColumns))
+    for i, column := range exportColumns {
+        value := values[i]
+        switch {
+        case exportJSONColumns[column] && json.Valid([]byte(value)):
+            record[column] = json.RawMessage(value)
+        case column == "latitude" || column == "longitude":
+            if f, err := strconv.ParseFloat(value, 64); err == nil {
+                record[column] = f
+            } else {
+                record[column] = nil
+            }
+        default:
+            record[column] = value
+        }
+    }
+    return record
+}
+
+func exportFilename(state, district, format string, compress bool) string {
+    parts := []string{"villages"}
+    for _, part := range []string{state, district} {
+        slug := strings.Map(func(r rune) rune {
+            switch {
+            case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+                return r
+            case r == ' ' || r == '-':
+                return '-'
+            }
+            return -1
+        }, strings.ToLower(part))
+        if slug != "" {
+            parts = append(parts, slug)
+        }
+    }
+    name := strings.Join(parts, "_") + "." + format
+    if compress {
+        name += ".gz"
+    }
+    return name
+}
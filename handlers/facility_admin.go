@@ -0,0 +1,659 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "village_site/config"
+    "village_site/middleware"
+    "village_site/models"
+    "village_site/utils"
+
+    "github.com/gorilla/mux"
+    "github.com/lib/pq"
+)
+
+const (
+    // maxFacilityUpload caps the size and rows of a bulk upload
+    maxFacilityUploadBytes = 10 << 20
+    maxFacilityUploadRows  = 5000
+    // maxFacilityBodyBytes caps the body of a single create or update
+    maxFacilityBodyBytes = 1 << 20
+)
+
+// facilityDedupMeters is how close two facilities with the same normalized
+// title must be to count as duplicates
+func facilityDedupMeters() float64 {
+    return config.GetEnvFloat("FACILITY_DEDUP_METERS", 100)
+}
+
+type FacilityRecord struct {
+    ID int64 `json:"id"`
+    Facility
+}
+
+// FacilityInput is a facility as sent by clients. On update, fields left
+// out keep their current value.
+type FacilityInput struct {
+    Title       *string  `json:"title"`
+    Address     *string  `json:"address"`
+    State       *string  `json:"state"`
+    District    *string  `json:"district"`
+    Subdistrict *string  `json:"subdistrict"`
+    Village     *string  `json:"village"`
+    Latitude    *float64 `json:"latitude"`
+    Longitude   *float64 `json:"longitude"`
+}
+
+// apply copies the fields that are set onto f
+func (in FacilityInput) apply(f *Facility) {
+    for _, field := range []struct {
+        value *string
+        dest  *string
+    }{
+        {in.Title, &f.Title}, {in.Address, &f.Address}, {in.State, &f.State},
+        {in.District, &f.District}, {in.Subdistrict, &f.Subdistrict}, {in.Village, &f.Village},
+    } {
+        if field.value != nil {
+            *field.dest = strings.TrimSpace(*field.value)
+        }
+    }
+    if in.Latitude != nil {
+        f.Latitude = *in.Latitude
+    }
+    if in.Longitude != nil {
+        f.Longitude = *in.Longitude
+    }
+}
+
+func validateFacility(f Facility) error {
+    if f.Title == "" {
+        return fmt.Errorf("title is required")
+    }
+    if f.Latitude < indiaBounds[0] || f.Latitude > indiaBounds[1] || f.Longitude < indiaBounds[2] || f.Longitude > indiaBounds[3] {
+        return fmt.Errorf("latitude and longitude must lie within India")
+    }
+    return nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+    QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+    QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+const facilityRecordColumns = `
+    id,
+    COALESCE(title, ''),
+    COALESCE(address, ''),
+    COALESCE(state, ''),
+    COALESCE(district, ''),
+    COALESCE(subdistrict, ''),
+    COALESCE(village, ''),
+    COALESCE(NULLIF(trim(latitude::text), '')::float8, 0),
+    COALESCE(NULLIF(trim(longitude::text), '')::float8, 0)`
+
+func scanFacilityRecord(row interface{ Scan(...interface{}) error }) (FacilityRecord, error) {
+    var f FacilityRecord
+    err := row.Scan(&f.ID, &f.Title, &f.Address, &f.State, &f.District, &f.Subdistrict, &f.Village, &f.Latitude, &f.Longitude)
+    return f, err
+}
+
+func getFacilityRecord(ctx context.Context, q queryer, t models.FacilityType, id int64) (FacilityRecord, error) {
+    return scanFacilityRecord(q.QueryRowContext(ctx, fmt.Sprintf(`
+        SELECT %s FROM %s WHERE id = $1`, facilityRecordColumns, pq.QuoteIdentifier(t.Table)), id))
+}
+
+// findFacilityDuplicates returns the facilities of a type whose normalized
+// title equals f's and that lie within the dedup distance. excludeID skips
+// the facility being updated.
+func findFacilityDuplicates(ctx context.Context, q queryer, t models.FacilityType, f Facility, excludeID int64) ([]FacilityRecord, error) {
+    meters := facilityDedupMeters()
+    latDelta := meters / 111000
+    lonDelta := meters / (111000 * math.Max(math.Cos(f.Latitude*math.Pi/180), 0.01))
+
+    rows, err := q.QueryContext(ctx, fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE id <> $1
+        AND NULLIF(trim(latitude::text), '') IS NOT NULL
+        AND NULLIF(trim(longitude::text), '') IS NOT NULL
+        AND NULLIF(trim(latitude::text), '')::float8 BETWEEN $2 - $4 AND $2 + $4
+        AND NULLIF(trim(longitude::text), '')::float8 BETWEEN $3 - $5 AND $3 + $5`,
+        facilityRecordColumns, pq.QuoteIdentifier(t.Table)),
+        excludeID, f.Latitude, f.Longitude, latDelta, lonDelta)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    title := utils.NormalizePlaceName(f.Title)
+    var duplicates []FacilityRecord
+    for rows.Next() {
+        candidate, err := scanFacilityRecord(rows)
+        if err != nil {
+            return nil, err
+        }
+        if utils.NormalizePlaceName(candidate.Title) != title {
+            continue
+        }
+        if utils.CalculateDistance(f.Latitude, f.Longitude, candidate.Latitude, candidate.Longitude)*1000 <= meters {
+            duplicates = append(duplicates, candidate)
+        }
+    }
+    return duplicates, rows.Err()
+}
+
+func insertFacility(ctx context.Context, q queryer, t models.FacilityType, f Facility) (FacilityRecord, error) {
+    return scanFacilityRecord(q.QueryRowContext(ctx, fmt.Sprintf(`
+        INSERT INTO %s (title, address, state, district, subdistrict, village, latitude, longitude)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING %s`, pq.QuoteIdentifier(t.Table), facilityRecordColumns),
+        f.Title, f.Address, f.State, f.District, f.Subdistrict, f.Village, f.Latitude, f.Longitude))
+}
+
+// recordFacilityChange writes an audit log entry. before and after are nil
+// for creations and deletions respectively.
+func recordFacilityChange(ctx context.Context, q queryer, t models.FacilityType, id int64, action, user, source string, before, after *FacilityRecord) error {
+    toJSON := func(record *FacilityRecord) interface{} {
+        if record == nil {
+            return nil
+        }
+        data, _ := json.Marshal(record)
+        return string(data)
+    }
+    _, err := q.ExecContext(ctx, `
+        INSERT INTO facility_audit_log (facility_type, facility_id, action, changed_by, source, before, after)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+        t.Key, id, action, user, source, toJSON(before), toJSON(after))
+    return err
+}
+
+func facilityTypeFromRequest(w http.ResponseWriter, r *http.Request) (models.FacilityType, bool) {
+    t, ok := config.FindFacilityType(mux.Vars(r)["type"])
+    if !ok {
+        http.Error(w, "Unknown facility type", http.StatusNotFound)
+    }
+    return t, ok
+}
+
+func writeFacilityJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(body)
+}
+
+// CreateFacility adds a facility. A facility with the same normalized title
+// nearby is reported as a conflict unless allow_duplicate=true; with
+// dry_run=true nothing is written.
+func CreateFacility(w http.ResponseWriter, r *http.Request) {
+    t, ok := facilityTypeFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    var input FacilityInput
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFacilityBodyBytes)).Decode(&input); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    var f Facility
+    input.apply(&f)
+    if err := validateFacility(f); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    duplicates, err := findFacilityDuplicates(r.Context(), config.DB, t, f, 0)
+    if err != nil {
+        log.Printf("Error checking %s duplicates: %v", t.Key, err)
+        http.Error(w, "Error creating facility", http.StatusInternalServerError)
+        return
+    }
+    if len(duplicates) > 0 && r.URL.Query().Get("allow_duplicate") != "true" {
+        writeFacilityJSON(w, http.StatusConflict, map[string]interface{}{
+            "error":      "A facility with the same title already exists nearby",
+            "duplicates": duplicates,
+        })
+        return
+    }
+    if r.URL.Query().Get("dry_run") == "true" {
+        writeFacilityJSON(w, http.StatusOK, map[string]interface{}{
+            "dry_run":    true,
+            "action":     "create",
+            "facility":   f,
+            "duplicates": duplicates,
+        })
+        return
+    }
+
+    var created FacilityRecord
+    err = config.WithTransaction(r.Context(), func(tx *sql.Tx) error {
+        var err error
+        if created, err = insertFacility(r.Context(), tx, t, f); err != nil {
+            return err
+        }
+        return recordFacilityChange(r.Context(), tx, t, created.ID, "create", middleware.AdminUser(r), "api", nil, &created)
+    })
+    if err != nil {
+        log.Printf("Error creating %s: %v", t.Key, err)
+        http.Error(w, "Error creating facility", http.StatusInternalServerError)
+        return
+    }
+
+    writeFacilityJSON(w, http.StatusCreated, created)
+}
+
+// UpdateFacility changes the fields given in the body
+func UpdateFacility(w http.ResponseWriter, r *http.Request) {
+    t, ok := facilityTypeFromRequest(w, r)
+    if !ok {
+        return
+    }
+    id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid facility id", http.StatusBadRequest)
+        return
+    }
+
+    var input FacilityInput
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFacilityBodyBytes)).Decode(&input); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    dryRun := r.URL.Query().Get("dry_run") == "true"
+    var before, after FacilityRecord
+    var duplicates []FacilityRecord
+    status, message := http.StatusOK, ""
+
+    err = config.WithTransaction(r.Context(), func(tx *sql.Tx) error {
+        var err error
+        before, err = scanFacilityRecord(tx.QueryRowContext(r.Context(), fmt.Sprintf(`
+            SELECT %s FROM %s WHERE id = $1 FOR UPDATE`, facilityRecordColumns, pq.QuoteIdentifier(t.Table)), id))
+        if err == sql.ErrNoRows {
+            status, message = http.StatusNotFound, "Facility not found"
+            return err
+        }
+        if err != nil {
+            return err
+        }
+
+        after = before
+        input.apply(&after.Facility)
+        if err := validateFacility(after.Facility); err != nil {
+            status, message = http.StatusBadRequest, err.Error()
+            return err
+        }
+
+        if duplicates, err = findFacilityDuplicates(r.Context(), tx, t, after.Facility, id); err != nil {
+            return err
+        }
+        if len(duplicates) > 0 && r.URL.Query().Get("allow_duplicate") != "true" {
+            status, message = http.StatusConflict, "A facility with the same title already exists nearby"
+            return fmt.Errorf("duplicate facility")
+        }
+        if dryRun {
+            return nil
+        }
+
+        if _, err := tx.ExecContext(r.Context(), fmt.Sprintf(`
+            UPDATE %s
+            SET title = $2, address = $3, state = $4, district = $5, subdistrict = $6,
+                village = $7, latitude = $8, longitude = $9
+            WHERE id = $1`, pq.QuoteIdentifier(t.Table)),
+            id, after.Title, after.Address, after.State, after.District, after.Subdistrict,
+            after.Village, after.Latitude, after.Longitude); err != nil {
+            return err
+        }
+        return recordFacilityChange(r.Context(), tx, t, id, "update", middleware.AdminUser(r), "api", &before, &after)
+    })
+
+    switch {
+    case status == http.StatusConflict:
+        writeFacilityJSON(w, status, map[string]interface{}{"error": message, "duplicates": duplicates})
+    case status != http.StatusOK:
+        http.Error(w, message, status)
+    case err != nil:
+        log.Printf("Error updating %s %d: %v", t.Key, id, err)
+        http.Error(w, "Error updating facility", http.StatusInternalServerError)
+    case dryRun:
+        writeFacilityJSON(w, http.StatusOK, map[string]interface{}{
+            "dry_run": true,
+            "action":  "update",
+            "before":  before,
+            "after":   after,
+        })
+    default:
+        writeFacilityJSON(w, http.StatusOK, after)
+    }
+}
+
+// DeleteFacility removes a facility, keeping its last state in the audit log
+func DeleteFacility(w http.ResponseWriter, r *http.Request) {
+    t, ok := facilityTypeFromRequest(w, r)
+    if !ok {
+        return
+    }
+    id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid facility id", http.StatusBadRequest)
+        return
+    }
+
+    var before FacilityRecord
+    err = config.WithTransaction(r.Context(), func(tx *sql.Tx) error {
+        var err error
+        if before, err = getFacilityRecord(r.Context(), tx, t, id); err != nil {
+            return err
+        }
+        if _, err := tx.ExecContext(r.Context(), fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, pq.QuoteIdentifier(t.Table)), id); err != nil {
+            return err
+        }
+        return recordFacilityChange(r.Context(), tx, t, id, "delete", middleware.AdminUser(r), "api", &before, nil)
+    })
+    if err == sql.ErrNoRows {
+        http.Error(w, "Facility not found", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        log.Printf("Error deleting %s %d: %v", t.Key, id, err)
+        http.Error(w, "Error deleting facility", http.StatusInternalServerError)
+        return
+    }
+
+    writeFacilityJSON(w, http.StatusOK, map[string]interface{}{
+        "status":  "deleted",
+        "deleted": before,
+    })
+}
+
+// FacilityUploadRow is the outcome of one row of a bulk upload
+type FacilityUploadRow struct {
+    Row         int              `json:"row"`
+    Action      string           `json:"action"` // "create", "duplicate" or "invalid"
+    Error       string           `json:"error,omitempty"`
+    Facility    Facility         `json:"facility"`
+    Duplicates  []FacilityRecord `json:"duplicates,omitempty"`
+    DuplicateOf int              `json:"duplicate_of_row,omitempty"`
+    ID          int64            `json:"id,omitempty"`
+}
+
+// parseFacilityCSV reads facilities from CSV with a header row naming the
+// columns (title, address, state, district, subdistrict, village, latitude,
+// longitude; also lat/lon/lng and name)
+func parseFacilityCSV(body io.Reader) ([]FacilityInput, error) {
+    reader := csv.NewReader(body)
+    reader.TrimLeadingSpace = true
+    header, err := reader.Read()
+    if err != nil {
+        return nil, fmt.Errorf("error reading CSV header: %v", err)
+    }
+
+    columns := make(map[string]int)
+    for i, name := range header {
+        name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+        switch name {
+        case "name":
+            name = "title"
+        case "lat":
+            name = "latitude"
+        case "lon", "lng":
+            name = "longitude"
+        }
+        columns[name] = i
+    }
+    if _, ok := columns["title"]; !ok {
+        return nil, fmt.Errorf("CSV needs a title column")
+    }
+
+    var inputs []FacilityInput
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("error reading CSV: %v", err)
+        }
+        if len(inputs) >= maxFacilityUploadRows {
+            return nil, fmt.Errorf("uploads are limited to %d rows", maxFacilityUploadRows)
+        }
+
+        field := func(name string) *string {
+            if i, ok := columns[name]; ok && i < len(record) {
+                value := record[i]
+                return &value
+            }
+            return nil
+        }
+        number := func(name string) *float64 {
+            if value := field(name); value != nil {
+                if f, err := strconv.ParseFloat(strings.TrimSpace(*value), 64); err == nil {
+                    return &f
+                }
+            }
+            return nil
+        }
+
+        inputs = append(inputs, FacilityInput{
+            Title: field("title"), Address: field("address"), State: field("state"),
+            District: field("district"), Subdistrict: field("subdistrict"), Village: field("village"),
+            Latitude: number("latitude"), Longitude: number("longitude"),
+        })
+    }
+    return inputs, nil
+}
+
+// parseFacilityGeoJSON reads facilities from a FeatureCollection of points;
+// the properties carry the other fields
+func parseFacilityGeoJSON(body io.Reader) ([]FacilityInput, error) {
+    var collection struct {
+        Features []struct {
+            Geometry struct {
+                Type        string    `json:"type"`
+                Coordinates []float64 `json:"coordinates"`
+            } `json:"geometry"`
+            Properties map[string]interface{} `json:"properties"`
+        } `json:"features"`
+    }
+    if err := json.NewDecoder(body).Decode(&collection); err != nil {
+        return nil, fmt.Errorf("error reading GeoJSON: %v", err)
+    }
+    if len(collection.Features) > maxFacilityUploadRows {
+        return nil, fmt.Errorf("uploads are limited to %d rows", maxFacilityUploadRows)
+    }
+
+    inputs := make([]FacilityInput, 0, len(collection.Features))
+    for _, feature := range collection.Features {
+        property := func(names ...string) *string {
+            for _, name := range names {
+                if value, ok := feature.Properties[name]; ok && value != nil {
+                    s := fmt.Sprint(value)
+                    return &s
+                }
+            }
+            return nil
+        }
+        input := FacilityInput{
+            Title: property("title", "name"), Address: property("address"), State: property("state"),
+            District: property("district"), Subdistrict: property("subdistrict"), Village: property("village"),
+        }
+        if feature.Geometry.Type == "Point" && len(feature.Geometry.Coordinates) >= 2 {
+            lon, lat := feature.Geometry.Coordinates[0], feature.Geometry.Coordinates[1]
+            input.Latitude, input.Longitude = &lat, &lon
+        }
+        inputs = append(inputs, input)
+    }
+    return inputs, nil
+}
+
+// UploadFacilities creates facilities in bulk from CSV (text/csv) or GeoJSON
+// (application/geo+json or application/json). Rows that duplicate an
+// existing facility or an earlier row are skipped. With dry_run=true the
+// outcome of every row is reported and nothing is written; otherwise all
+// rows are written in one transaction.
+func UploadFacilities(w http.ResponseWriter, r *http.Request) {
+    t, ok := facilityTypeFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    body := http.MaxBytesReader(w, r.Body, maxFacilityUploadBytes)
+    var inputs []FacilityInput
+    var err error
+    contentType := r.Header.Get("Content-Type")
+    switch {
+    case strings.HasPrefix(contentType, "text/csv"):
+        inputs, err = parseFacilityCSV(body)
+    case strings.Contains(contentType, "json"):
+        inputs, err = parseFacilityGeoJSON(body)
+    default:
+        http.Error(w, "Content-Type must be text/csv or application/geo+json", http.StatusUnsupportedMediaType)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    dryRun := r.URL.Query().Get("dry_run") == "true"
+    user := middleware.AdminUser(r)
+    meters := facilityDedupMeters()
+    results := make([]FacilityUploadRow, len(inputs))
+    summary := map[string]int{"create": 0, "duplicate": 0, "invalid": 0}
+    // creates holds the rows to be created so far by normalized title, so a
+    // row is only compared with earlier rows of the same title
+    creates := make(map[string][]int)
+
+    err = config.WithTransaction(r.Context(), func(tx *sql.Tx) error {
+        for i, input := range inputs {
+            result := &results[i]
+            result.Row = i + 1
+            input.apply(&result.Facility)
+            if input.Latitude == nil || input.Longitude == nil {
+                result.Action, result.Error = "invalid", "latitude and longitude are required"
+                continue
+            }
+            if err := validateFacility(result.Facility); err != nil {
+                result.Action, result.Error = "invalid", err.Error()
+                continue
+            }
+
+            // Duplicates within the upload itself
+            title := utils.NormalizePlaceName(result.Facility.Title)
+            for _, j := range creates[title] {
+                earlier := results[j]
+                if utils.CalculateDistance(earlier.Facility.Latitude, earlier.Facility.Longitude,
+                    result.Facility.Latitude, result.Facility.Longitude)*1000 <= meters {
+                    result.Action, result.DuplicateOf = "duplicate", earlier.Row
+                    break
+                }
+            }
+            if result.Action != "" {
+                continue
+            }
+
+            duplicates, err := findFacilityDuplicates(r.Context(), tx, t, result.Facility, 0)
+            if err != nil {
+                return err
+            }
+            if len(duplicates) > 0 {
+                result.Action, result.Duplicates = "duplicate", duplicates
+                continue
+            }
+
+            result.Action = "create"
+            creates[title] = append(creates[title], i)
+            if dryRun {
+                continue
+            }
+            created, err := insertFacility(r.Context(), tx, t, result.Facility)
+            if err != nil {
+                return fmt.Errorf("row %d: %v", result.Row, err)
+            }
+            result.ID = created.ID
+            if err := recordFacilityChange(r.Context(), tx, t, created.ID, "create", user, "bulk", nil, &created); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        log.Printf("Error uploading %s facilities: %v", t.Key, err)
+        http.Error(w, "Error uploading facilities", http.StatusInternalServerError)
+        return
+    }
+
+    for _, result := range results {
+        summary[result.Action]++
+    }
+    writeFacilityJSON(w, http.StatusOK, map[string]interface{}{
+        "dry_run": dryRun,
+        "type":    t.Key,
+        "summary": summary,
+        "rows":    results,
+    })
+}
+
+// GetFacilityAuditLog lists recorded changes, newest first, optionally for
+// one type, facility or user
+func GetFacilityAuditLog(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    facilityID, _ := strconv.ParseInt(q.Get("id"), 10, 64)
+    limit, _ := strconv.Atoi(q.Get("limit"))
+    if limit < 1 || limit > 500 {
+        limit = 100
+    }
+
+    rows, err := config.DB.QueryContext(r.Context(), `
+        SELECT id, facility_type, facility_id, action, changed_by, changed_at, source,
+            COALESCE(before::text, 'null'), COALESCE(after::text, 'null')
+        FROM facility_audit_log
+        WHERE ($1 = '' OR facility_type = $1)
+        AND ($2 = 0 OR facility_id = $2)
+        AND ($3 = '' OR changed_by = $3)
+        ORDER BY changed_at DESC, id DESC
+        LIMIT $4`, q.Get("type"), facilityID, q.Get("user"), limit)
+    if err != nil {
+        log.Printf("Error reading facility audit log: %v", err)
+        http.Error(w, "Error reading audit log", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    entries := make([]map[string]interface{}, 0)
+    for rows.Next() {
+        var id, facilityID int64
+        var facilityType, action, changedBy, source, before, after string
+        var changedAt interface{}
+        if err := rows.Scan(&id, &facilityType, &facilityID, &action, &changedBy, &changedAt, &source, &before, &after); err != nil {
+            log.Printf("Error scanning audit entry: %v", err)
+            continue
+        }
+        entries = append(entries, map[string]interface{}{
+            "id":          id,
+            "type":        facilityType,
+            "facility_id": facilityID,
+            "action":      action,
+            "changed_by":  changedBy,
+            "changed_at":  changedAt,
+            "source":      source,
+            "before":      json.RawMessage(before),
+            "after":       json.RawMessage(after),
+        })
+    }
+
+    writeFacilityJSON(w, http.StatusOK, map[string]interface{}{
+        "entries": entries,
+    })
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "village_site/config"
+    "village_site/models"
+
+    "github.com/lib/pq"
+)
+
+const (
+    defaultFacilityRadiusKm = 10.0
+    maxFacilityRadiusKm     = 100.0
+    defaultFacilityLimit    = 20
+    maxFacilityLimit        = 200
+)
+
+// queryNearbyFacilities returns the facilities of one type within radiusKm
+// of a point, nearest first
+func queryNearbyFacilities(ctx context.Context, facilityType models.FacilityType, lat, lon, radiusKm float64, limit int) ([]NearbyFacility, error) {
+    // Degrees of latitude and longitude spanned by the radius, to narrow the
+    // scan to a box before computing distances
+    latDelta := radiusKm / 111.0
+    lonDelta := radiusKm / (111.0 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+
+    query := fmt.Sprintf(`
+        SELECT title, address, lat, lon, ROUND(distance::numeric, 2)::float8
+        FROM (
+            SELECT
+                title, address, lat, lon,
+                6371 * acos(LEAST(1.0,
+                    cos(radians($1)) * cos(radians(lat)) * cos(radians(lon) - radians($2)) +
+                    sin(radians($1)) * sin(radians(lat))
+                )) AS distance
+            FROM (
+                SELECT
+                    COALESCE(title, '') AS title,
+                    COALESCE(address, '') AS address,
+                    NULLIF(trim(latitude::text), '')::float8 AS lat,
+                    NULLIF(trim(longitude::text), '')::float8 AS lon
+                FROM %s
+                WHERE NULLIF(trim(latitude::text), '') IS NOT NULL
+                AND NULLIF(trim(longitude::text), '') IS NOT NULL
+                AND title IS NOT NULL
+            ) f
+            WHERE lat BETWEEN $1 - $3 AND $1 + $3
+            AND lon BETWEEN $2 - $4 AND $2 + $4
+            AND lat <> 0 AND lon <> 0
+        ) d
+        WHERE distance <= $5
+        ORDER BY distance
+        LIMIT $6`, pq.QuoteIdentifier(facilityType.Table))
+
+    rows, err := config.DB.QueryContext(ctx, query, lat, lon, latDelta, lonDelta, radiusKm, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    facilities := make([]NearbyFacility, 0)
+    for rows.Next() {
+        var f NearbyFacility
+        if err := rows.Scan(&f.Title, &f.Address, &f.Latitude, &f.Longitude, &f.Distance); err != nil {
+            return nil, err
+        }
+        facilities = append(facilities, f)
+    }
+    return facilities, rows.Err()
+}
+
+// addTravelTimes estimates the travel time to each facility by every mode
+func addTravelTimes(facilities []NearbyFacility, state string) {
+    for i := range facilities {
+        facilities[i].TravelTimes = calculateTravelTimes(facilities[i].Distance, state)
+    }
+}
+
+// GetFacilityTypes lists the registered facility types
+func GetFacilityTypes(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "public, max-age=3600")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "types": config.FacilityTypes(),
+    })
+}
+
+// GetNearbyFacilities returns the facilities of one type near a point,
+// within a straight-line radius or, given mode and max_minutes, within an
+// estimated travel time. Speeds are those of the state, if given.
+func GetNearbyFacilities(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    facilityType, ok := config.FindFacilityType(q.Get("type"))
+    if !ok {
+        http.Error(w, "Unknown facility type", http.StatusBadRequest)
+        return
+    }
+
+    lat, errLat := strconv.ParseFloat(q.Get("lat"), 64)
+    lon, errLon := strconv.ParseFloat(q.Get("lon"), 64)
+    if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+        http.Error(w, "Valid lat and lon are required", http.StatusBadRequest)
+        return
+    }
+    state := q.Get("state")
+
+    radius := defaultFacilityRadiusKm
+    if raw := q.Get("radius"); raw != "" {
+        var err error
+        if radius, err = strconv.ParseFloat(raw, 64); err != nil || radius <= 0 {
+            http.Error(w, "Radius must be a positive number of km", http.StatusBadRequest)
+            return
+        }
+    }
+
+    // A travel time limit becomes the straight-line radius that can be
+    // covered in that time
+    mode := q.Get("mode")
+    var maxMinutes float64
+    if raw := q.Get("max_minutes"); raw != "" || mode != "" {
+        speed, ok := config.TravelSpeeds(state)[mode]
+        if !ok {
+            http.Error(w, "Unknown travel mode", http.StatusBadRequest)
+            return
+        }
+        var err error
+        if maxMinutes, err = strconv.ParseFloat(raw, 64); err != nil || maxMinutes <= 0 {
+            http.Error(w, "max_minutes must be a positive number", http.StatusBadRequest)
+            return
+        }
+        reachable := maxMinutes / 60 * speed / roadDistance(1)
+        if q.Get("radius") == "" || reachable < radius {
+            radius = reachable
+        }
+    }
+    radius = math.Min(radius, maxFacilityRadiusKm)
+
+    limit := defaultFacilityLimit
+    if raw := q.Get("limit"); raw != "" {
+        var err error
+        if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+            http.Error(w, "Limit must be a positive integer", http.StatusBadRequest)
+            return
+        }
+        if limit > maxFacilityLimit {
+            limit = maxFacilityLimit
+        }
+    }
+
+    facilities, err := queryNearbyFacilities(r.Context(), facilityType, lat, lon, radius, limit)
+    if err != nil {
+        log.Printf("Error querying nearby %s: %v", facilityType.Key, err)
+        http.Error(w, "Error fetching nearby facilities", http.StatusInternalServerError)
+        return
+    }
+    addTravelTimes(facilities, state)
+
+    response := map[string]interface{}{
+        "type":       facilityType,
+        "radius_km":  math.Round(radius*100) / 100,
+        "limit":      limit,
+        "facilities": facilities,
+    }
+    if mode != "" {
+        response["mode"] = mode
+        response["max_minutes"] = maxMinutes
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "public, max-age=300")
+    json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "village_site/config"
+    "village_site/models"
+
+    "github.com/lib/pq"
+)
+
+// facilityDistanceScaleKm is the distance at which a result's relevance is
+// halved when a reference point is given
+const facilityDistanceScaleKm = 10.0
+
+// facilityPlaceSuffix splits "sbi atm in asifabad" into what and where
+var facilityPlaceSuffix = regexp.MustCompile(`(?i)^(.+?)\s+(?:in|at|near)\s+(.+)$`)
+
+// facilityAreaWords are dropped from the place part of a query
+var facilityAreaWords = regexp.MustCompile(`(?i)\b(district|mandal|tehsil|taluk|taluka|village|subdistrict)\b`)
+
+// likeEscaper escapes the LIKE wildcards in user text, so "%" and "_" match
+// themselves. Backslash is PostgreSQL's default LIKE escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type FacilitySearchResult struct {
+    Type        string   `json:"type"`
+    DisplayName string   `json:"display_name"`
+    Icon        string   `json:"icon"`
+    Title       string   `json:"title"`
+    Address     string   `json:"address"`
+    State       string   `json:"state"`
+    District    string   `json:"district"`
+    Subdistrict string   `json:"subdistrict"`
+    Village     string   `json:"village"`
+    Latitude    float64  `json:"latitude"`
+    Longitude   float64  `json:"longitude"`
+    Distance    *float64 `json:"distance,omitempty"`
+    Score       float64  `json:"score"`
+}
+
+// facilitySearchQuery is the interpretation of a free text query
+type facilitySearchQuery struct {
+    Terms []string `json:"terms"`
+    Types []string `json:"types"`
+    Place string   `json:"place,omitempty"`
+}
+
+// facilityTypeWords maps singular and plural words and phrases to facility
+// types, e.g. "hospital" and "hospitals" to hospitals and "petrol pumps" to
+// petrol_pump
+func facilityTypeWords() map[string]string {
+    words := make(map[string]string)
+    for _, t := range config.FacilityTypes() {
+        for _, word := range []string{t.Key, t.ResponseKey, t.DisplayName} {
+            word = strings.ToLower(strings.ReplaceAll(word, "_", " "))
+            words[word] = t.Key
+            words[strings.TrimSuffix(word, "s")] = t.Key
+        }
+    }
+    return words
+}
+
+// parseFacilityQuery picks facility types and a trailing "in <place>" out of
+// the text; whatever remains must appear in the title or address. The caller
+// checks the place with isKnownArea.
+func parseFacilityQuery(text string, withPlace bool) facilitySearchQuery {
+    var parsed facilitySearchQuery
+    text = strings.TrimSpace(text)
+
+    if withPlace {
+        if m := facilityPlaceSuffix.FindStringSubmatch(text); m != nil {
+            text = m[1]
+            parsed.Place = strings.Join(strings.Fields(facilityAreaWords.ReplaceAllString(m[2], " ")), " ")
+        }
+    }
+
+    // The last words naming a facility type pick the type; earlier ones
+    // describe it ("government hospital" is a hospital). The longest phrase
+    // wins, so "police station" is not read as "station".
+    typeWords := facilityTypeWords()
+    terms := strings.Fields(strings.ToLower(text))
+    for end := len(terms); end > 0 && parsed.Types == nil; end-- {
+        for start := 0; start < end; start++ {
+            if key, ok := typeWords[strings.Join(terms[start:end], " ")]; ok {
+                parsed.Types = []string{key}
+                terms = append(terms[:start], terms[end:]...)
+                break
+            }
+        }
+    }
+    parsed.Terms = terms
+    return parsed
+}
+
+// isKnownArea reports whether place is the name of a district, subdistrict
+// or village, so "atm near me" or "clinic at night" are not read as places
+func isKnownArea(ctx context.Context, place string) (bool, error) {
+    var known bool
+    err := config.DB.QueryRowContext(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM place_search_keys
+            WHERE LOWER(name) = LOWER($1) AND kind IN ('district', 'subdistrict', 'locality')
+        )`, place).Scan(&known)
+    return known, err
+}
+
+// SearchFacilities searches every facility table by title and address.
+// Results can be narrowed by type and administrative area and, given lat and
+// lon, nearer facilities rank higher.
+func SearchFacilities(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    state := strings.TrimSpace(q.Get("state"))
+    district := strings.TrimSpace(q.Get("district"))
+    subdistrict := strings.TrimSpace(q.Get("subdistrict"))
+    village := strings.TrimSpace(q.Get("village"))
+
+    // "in <place>" is only read from the text when no area is given
+    withPlace := state == "" && district == "" && subdistrict == "" && village == ""
+    parsed := parseFacilityQuery(q.Get("q"), withPlace)
+    if parsed.Place != "" {
+        known, err := isKnownArea(r.Context(), parsed.Place)
+        if err != nil {
+            log.Printf("Error checking search place %q: %v", parsed.Place, err)
+        }
+        if !known {
+            // the words after "in", "at" or "near" are search terms then
+            parsed = parseFacilityQuery(q.Get("q"), false)
+        }
+    }
+
+    var types []models.FacilityType
+    if raw := q.Get("type"); raw != "" {
+        parsed.Types = nil
+        for _, key := range strings.Split(raw, ",") {
+            t, ok := config.FindFacilityType(strings.TrimSpace(key))
+            if !ok {
+                http.Error(w, "Unknown facility type: "+key, http.StatusBadRequest)
+                return
+            }
+            types = append(types, t)
+            parsed.Types = append(parsed.Types, t.Key)
+        }
+    } else if len(parsed.Types) > 0 {
+        for _, key := range parsed.Types {
+            t, _ := config.FindFacilityType(key)
+            types = append(types, t)
+        }
+    } else {
+        types = config.FacilityTypes()
+    }
+
+    if len(parsed.Terms) == 0 && len(parsed.Types) == 0 {
+        http.Error(w, "Search query or type is required", http.StatusBadRequest)
+        return
+    }
+
+    var lat, lon float64
+    hasPoint := q.Get("lat") != "" || q.Get("lon") != ""
+    if hasPoint {
+        var errLat, errLon error
+        lat, errLat = strconv.ParseFloat(q.Get("lat"), 64)
+        lon, errLon = strconv.ParseFloat(q.Get("lon"), 64)
+        if errLat != nil || errLon != nil {
+            http.Error(w, "Valid lat and lon are required", http.StatusBadRequest)
+            return
+        }
+    }
+
+    page, _ := strconv.Atoi(q.Get("page"))
+    if page < 1 {
+        page = 1
+    }
+    limit, _ := strconv.Atoi(q.Get("limit"))
+    if limit < 1 || limit > 100 {
+        limit = 20
+    }
+
+    patterns := make([]string, len(parsed.Terms))
+    for i, term := range parsed.Terms {
+        patterns[i] = "%" + likeEscaper.Replace(term) + "%"
+    }
+    phrase := ""
+    if len(parsed.Terms) > 1 {
+        phrase = "%" + likeEscaper.Replace(strings.Join(parsed.Terms, " ")) + "%"
+    }
+
+    // One branch per facility table: every term must appear in the title or
+    // address; title hits count double and the whole phrase adds a bonus
+    var branches []string
+    for _, t := range types {
+        branches = append(branches, fmt.Sprintf(`
+            SELECT
+                %s AS type,
+                COALESCE(title, '') AS title,
+                COALESCE(address, '') AS address,
+                COALESCE(state, '') AS state,
+                COALESCE(district, '') AS district,
+                COALESCE(subdistrict, '') AS subdistrict,
+                COALESCE(village, '') AS village,
+                COALESCE(NULLIF(trim(latitude::text), '')::float8, 0) AS lat,
+                COALESCE(NULLIF(trim(longitude::text), '')::float8, 0) AS lon,
+                (
+                    SELECT COALESCE(SUM(CASE WHEN title ILIKE p THEN 2 ELSE 1 END), 0)
+                    FROM unnest($1::text[]) p
+                ) + CASE WHEN $2 <> '' AND title ILIKE $2 THEN 3 ELSE 0 END AS text_score
+            FROM %s
+            WHERE NOT EXISTS (
+                SELECT 1 FROM unnest($1::text[]) p
+                WHERE NOT (COALESCE(title, '') ILIKE p OR COALESCE(address, '') ILIKE p)
+            )
+            AND ($3 = '' OR LOWER(state) = LOWER($3))
+            AND ($4 = '' OR LOWER(district) = LOWER($4))
+            AND ($5 = '' OR LOWER(subdistrict) = LOWER($5))
+            AND ($6 = '' OR LOWER(village) = LOWER($6))
+            AND ($7 = '' OR LOWER(district) = LOWER($7) OR LOWER(subdistrict) = LOWER($7) OR LOWER(village) = LOWER($7))`,
+            pq.QuoteLiteral(t.Key), pq.QuoteIdentifier(t.Table)))
+    }
+
+    query := `
+        WITH matches AS (` + strings.Join(branches, "\n            UNION ALL") + `
+        ),
+        scored AS (
+            SELECT *,
+                CASE WHEN $8 AND lat <> 0 AND lon <> 0 THEN
+                    6371 * acos(LEAST(1.0,
+                        cos(radians($9)) * cos(radians(lat)) * cos(radians(lon) - radians($10)) +
+                        sin(radians($9)) * sin(radians(lat))
+                    ))
+                END AS distance
+            FROM matches
+        )
+        SELECT type, title, address, state, district, subdistrict, village, lat, lon, distance,
+            (1 + text_score) / (1 + COALESCE(distance, CASE WHEN $8 THEN 1000 ELSE 0 END) / $11) AS score
+        FROM scored
+        ORDER BY score DESC, distance NULLS LAST, title
+        LIMIT $12 OFFSET $13`
+
+    rows, err := config.DB.QueryContext(r.Context(), query,
+        pq.Array(patterns), phrase, state, district, subdistrict, village, parsed.Place,
+        hasPoint, lat, lon, facilityDistanceScaleKm, limit, (page-1)*limit)
+    if err != nil {
+        log.Printf("Error searching facilities: %v", err)
+        http.Error(w, "Error searching facilities", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    results := make([]FacilitySearchResult, 0)
+    for rows.Next() {
+        var result FacilitySearchResult
+        var distance *float64
+        if err := rows.Scan(&result.Type, &result.Title, &result.Address, &result.State, &result.District,
+            &result.Subdistrict, &result.Village, &result.Latitude, &result.Longitude, &distance, &result.Score); err != nil {
+            log.Printf("Error scanning facility result: %v", err)
+            continue
+        }
+        if distance != nil {
+            rounded := math.Round(*distance*100) / 100
+            result.Distance = &rounded
+        }
+        if t, ok := config.FindFacilityType(result.Type); ok {
+            result.DisplayName, result.Icon = t.DisplayName, t.Icon
+        }
+        results = append(results, result)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "public, max-age=300")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "results": results,
+        "query":   parsed,
+        "page":    page,
+        "limit":   limit,
+    })
+}
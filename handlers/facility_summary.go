@@ -0,0 +1,204 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "strings"
+    "time"
+    "village_site/config"
+
+    "github.com/gorilla/mux"
+    "github.com/lib/pq"
+)
+
+// FacilityCount is the number of facilities of one type in an area and
+// their density per 1,000 residents
+type FacilityCount struct {
+    Count   int      `json:"count"`
+    Per1000 *float64 `json:"per_1000"`
+}
+
+type FacilityAreaSummary struct {
+    State       string                   `json:"state"`
+    District    string                   `json:"district"`
+    Subdistrict string                   `json:"subdistrict,omitempty"`
+    Population  int64                    `json:"population"`
+    Total       FacilityCount            `json:"total"`
+    Facilities  map[string]FacilityCount `json:"facilities"`
+    RefreshedAt time.Time                `json:"refreshed_at"`
+}
+
+func newFacilityCount(count int, population int64) FacilityCount {
+    c := FacilityCount{Count: count}
+    if population > 0 {
+        density := math.Round(float64(count)/float64(population)*1000*1000) / 1000
+        c.Per1000 = &density
+    }
+    return c
+}
+
+// RefreshFacilitySummary rebuilds facility_summary: the number of facilities
+// of each type per subdistrict and district, with the census population of
+// the area. Areas are matched by lowercased state and name. village_census
+// has no state column, so census areas take the state of their villages
+// where it is unambiguous; a population is only used when it matches one
+// state.
+func RefreshFacilitySummary(ctx context.Context) error {
+    var counts []string
+    for _, t := range config.FacilityTypes() {
+        counts = append(counts, fmt.Sprintf(`
+            SELECT %s AS facility_type,
+                COALESCE(LOWER(trim(state)), '') AS state,
+                LOWER(trim(district)) AS district,
+                COALESCE(LOWER(trim(subdistrict)), '') AS subdistrict,
+                COUNT(*) AS facilities
+            FROM %s
+            WHERE NULLIF(trim(district), '') IS NOT NULL
+            GROUP BY 2, 3, 4`, pq.QuoteLiteral(t.Key), pq.QuoteIdentifier(t.Table)))
+    }
+
+    // population prefers the area of the same state, then one area of an
+    // unknown state, or an area of the only state when the count has none
+    population := func(table, match string) string {
+        return fmt.Sprintf(`COALESCE((
+            SELECT CASE
+                WHEN bool_or(p.state = t.state) THEN MAX(p.population) FILTER (WHERE p.state = t.state)
+                WHEN COUNT(*) = 1 THEN MAX(p.population)
+            END
+            FROM %s p
+            WHERE %s AND (p.state = t.state OR p.state = '' OR t.state = '')
+        ), 0)`, table, match)
+    }
+
+    insert := `
+        WITH counts AS (` + strings.Join(counts, "\n            UNION ALL") + `
+        ),
+        census_states AS (
+            SELECT LOWER(trim(district)) AS district, LOWER(trim(subdistrict)) AS subdistrict,
+                MIN(LOWER(trim(state))) AS state
+            FROM villages
+            WHERE NULLIF(trim(state), '') IS NOT NULL
+            GROUP BY 1, 2
+            HAVING COUNT(DISTINCT LOWER(trim(state))) = 1
+        ),
+        subdistrict_population AS (
+            SELECT COALESCE(s.state, '') AS state, LOWER(trim(vc.district)) AS district,
+                LOWER(trim(vc.subdistrict)) AS subdistrict,
+                SUM(COALESCE(NULLIF(trim(vc.total_population::text), '')::float8, 0))::bigint AS population
+            FROM village_census vc
+            LEFT JOIN census_states s
+                ON s.district = LOWER(trim(vc.district)) AND s.subdistrict = LOWER(trim(vc.subdistrict))
+            GROUP BY 1, 2, 3
+        ),
+        district_population AS (
+            SELECT state, district, SUM(population)::bigint AS population
+            FROM subdistrict_population
+            GROUP BY state, district
+        ),
+        subdistrict_counts AS (
+            SELECT state, district, subdistrict, facility_type, SUM(facilities) AS facilities
+            FROM counts
+            GROUP BY 1, 2, 3, 4
+        ),
+        district_counts AS (
+            SELECT state, district, facility_type, SUM(facilities) AS facilities
+            FROM counts
+            GROUP BY 1, 2, 3
+        )
+        INSERT INTO facility_summary (level, state, district, subdistrict, facility_type, facilities, population)
+        SELECT 'subdistrict', t.state, t.district, t.subdistrict, t.facility_type, t.facilities,
+            ` + population("subdistrict_population", "p.district = t.district AND p.subdistrict = t.subdistrict") + `
+        FROM subdistrict_counts t
+        UNION ALL
+        SELECT 'district', t.state, t.district, '', t.facility_type, t.facilities,
+            ` + population("district_population", "p.district = t.district") + `
+        FROM district_counts t`
+
+    return config.WithTransaction(ctx, func(tx *sql.Tx) error {
+        if _, err := tx.ExecContext(ctx, `DELETE FROM facility_summary`); err != nil {
+            return fmt.Errorf("error clearing facility summary: %v", err)
+        }
+        if _, err := tx.ExecContext(ctx, insert); err != nil {
+            return fmt.Errorf("error computing facility summary: %v", err)
+        }
+        return nil
+    })
+}
+
+// getFacilitySummaries reads the summaries of one level ("district" or
+// "subdistrict"), optionally narrowed to a state, district and subdistrict
+func getFacilitySummaries(ctx context.Context, level, state, district, subdistrict string) ([]FacilityAreaSummary, error) {
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT state, district, subdistrict, facility_type, facilities, population, refreshed_at
+        FROM facility_summary
+        WHERE level = $1
+        AND ($2 = '' OR state = LOWER(trim($2)))
+        AND ($3 = '' OR district = LOWER(trim($3)))
+        AND ($4 = '' OR subdistrict = LOWER(trim($4)))
+        ORDER BY state, district, subdistrict`, level, state, district, subdistrict)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    summaries := make([]FacilityAreaSummary, 0)
+    var current *FacilityAreaSummary
+    total := 0
+    finish := func() {
+        if current != nil {
+            current.Total = newFacilityCount(total, current.Population)
+        }
+    }
+
+    for rows.Next() {
+        var s FacilityAreaSummary
+        var facilityType string
+        var count int
+        if err := rows.Scan(&s.State, &s.District, &s.Subdistrict, &facilityType, &count, &s.Population, &s.RefreshedAt); err != nil {
+            return nil, err
+        }
+
+        if current == nil || current.State != s.State || current.District != s.District || current.Subdistrict != s.Subdistrict {
+            finish()
+            s.Facilities = make(map[string]FacilityCount)
+            for _, t := range config.FacilityTypes() {
+                s.Facilities[t.Key] = newFacilityCount(0, s.Population)
+            }
+            summaries = append(summaries, s)
+            current = &summaries[len(summaries)-1]
+            total = 0
+        }
+
+        current.Facilities[facilityType] = newFacilityCount(count, current.Population)
+        total += count
+    }
+    finish()
+
+    return summaries, rows.Err()
+}
+
+// GetFacilitySummary serves /facilities/summary/{level} with level
+// "districts" or "subdistricts"
+func GetFacilitySummary(w http.ResponseWriter, r *http.Request) {
+    level := strings.TrimSuffix(mux.Vars(r)["level"], "s")
+    q := r.URL.Query()
+
+    summaries, err := getFacilitySummaries(r.Context(), level, q.Get("state"), q.Get("district"), q.Get("subdistrict"))
+    if err != nil {
+        log.Printf("Error reading facility summary: %v", err)
+        http.Error(w, "Error fetching facility summary", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "public, max-age=3600")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "level": level,
+        "areas": summaries,
+    })
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "village_site/config"
+    "village_site/models"
+
+    "github.com/lib/pq"
+)
+
+const (
+    defaultFeatureLimit = 5000
+    maxFeatureLimit     = 10000
+)
+
+// geoLayer describes which columns of a table may be exposed as GeoJSON
+// properties
+type geoLayer struct {
+    Fields        []string
+    DefaultFields []string
+}
+
+var villageGeoLayer = geoLayer{
+    Fields: []string{
+        "locality", "village_name", "state", "district", "subdistrict",
+        "pin_code", "post_office", "parliament_mp", "assembly_mla",
+        "language", "block", "tehsil", "division", "main_village",
+    },
+    DefaultFields: []string{"locality", "subdistrict", "district", "state"},
+}
+
+var facilityGeoLayer = geoLayer{
+    Fields:        []string{"title", "address", "state", "district", "subdistrict", "village"},
+    DefaultFields: []string{"title", "address"},
+}
+
+// selectFields resolves the fields parameter against the layer's allowed
+// columns
+func (l geoLayer) selectFields(raw string) ([]string, error) {
+    if strings.TrimSpace(raw) == "" {
+        return l.DefaultFields, nil
+    }
+
+    allowed := make(map[string]bool, len(l.Fields))
+    for _, f := range l.Fields {
+        allowed[f] = true
+    }
+
+    var fields []string
+    seen := make(map[string]bool)
+    for _, f := range strings.Split(raw, ",") {
+        f = strings.ToLower(strings.TrimSpace(f))
+        if f == "" || seen[f] {
+            continue
+        }
+        if !allowed[f] {
+            return nil, fmt.Errorf("unknown field %q, allowed fields: %s", f, strings.Join(l.Fields, ", "))
+        }
+        seen[f] = true
+        fields = append(fields, f)
+    }
+    return fields, nil
+}
+
+func featureLimit(raw string) int {
+    limit, err := strconv.Atoi(raw)
+    if err != nil || limit < 1 {
+        return defaultFeatureLimit
+    }
+    if limit > maxFeatureLimit {
+        return maxFeatureLimit
+    }
+    return limit
+}
+
+// scanFeatures turns rows of (latitude, longitude, fields...) into a capped
+// FeatureCollection. The query must fetch limit+1 rows so truncation can be
+// detected.
+func scanFeatures(rows *sql.Rows, fields []string, limit int) (models.FeatureCollection, error) {
+    collection := models.FeatureCollection{
+        Type:     "FeatureCollection",
+        Features: make([]models.Feature, 0),
+        Limit:    limit,
+    }
+
+    values := make([]string, len(fields))
+    var lat, lon float64
+    dest := []interface{}{&lat, &lon}
+    for i := range values {
+        dest = append(dest, &values[i])
+    }
+
+    for rows.Next() {
+        if len(collection.Features) == limit {
+            collection.Truncated = true
+            break
+        }
+        if err := rows.Scan(dest...); err != nil {
+            return collection, err
+        }
+        properties := make(map[string]interface{}, len(fields))
+        for i, f := range fields {
+            properties[f] = values[i]
+        }
+        collection.Features = append(collection.Features, models.NewPointFeature(lat, lon, properties))
+    }
+
+    return collection, rows.Err()
+}
+
+func fieldColumns(fields []string) string {
+    columns := make([]string, len(fields))
+    for i, f := range fields {
+        columns[i] = fmt.Sprintf("COALESCE(%s::text, '')", f)
+    }
+    if len(columns) == 0 {
+        return ""
+    }
+    return ", " + strings.Join(columns, ", ")
+}
+
+func writeGeoJSON(w http.ResponseWriter, collection models.FeatureCollection) {
+    w.Header().Set("Content-Type", "application/geo+json")
+    w.Header().Set("Cache-Control", "public, max-age=3600")
+    if err := json.NewEncoder(w).Encode(collection); err != nil {
+        log.Printf("Error encoding GeoJSON: %v", err)
+    }
+}
+
+// GetVillagesGeoJSON returns the villages of a district as a GeoJSON
+// FeatureCollection
+func GetVillagesGeoJSON(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    state := strings.TrimSpace(q.Get("state"))
+    district := strings.TrimSpace(q.Get("district"))
+    subdistrict := strings.TrimSpace(q.Get("subdistrict"))
+    if district == "" {
+        http.Error(w, "District is required", http.StatusBadRequest)
+        return
+    }
+
+    fields, err := villageGeoLayer.selectFields(q.Get("fields"))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    limit := featureLimit(q.Get("limit"))
+
+    query := fmt.Sprintf(`
+        SELECT
+            NULLIF(trim(latitude::text), '')::float8,
+            NULLIF(trim(longitude::text), '')::float8
+            %s
+        FROM villages
+        WHERE LOWER(district) = LOWER($1)
+        AND ($2 = '' OR LOWER(state) = LOWER($2))
+        AND ($3 = '' OR LOWER(subdistrict) = LOWER($3))
+        AND NULLIF(trim(latitude::text), '')::float8 <> 0
+        AND NULLIF(trim(longitude::text), '')::float8 <> 0
+        ORDER BY subdistrict, locality
+        LIMIT $4`, fieldColumns(fields))
+
+    rows, err := config.DB.QueryContext(r.Context(), query, district, state, subdistrict, limit+1)
+    if err != nil {
+        log.Printf("Error querying village features: %v", err)
+        http.Error(w, "Error fetching villages", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    collection, err := scanFeatures(rows, fields, limit)
+    if err != nil {
+        log.Printf("Error scanning village features: %v", err)
+        http.Error(w, "Error fetching villages", http.StatusInternalServerError)
+        return
+    }
+
+    writeGeoJSON(w, collection)
+}
+
+// parseBBox parses "minLon,minLat,maxLon,maxLat"
+func parseBBox(raw string) (minLon, minLat, maxLon, maxLat float64, err error) {
+    parts := strings.Split(raw, ",")
+    if len(parts) != 4 {
+        return 0, 0, 0, 0, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+    }
+
+    var v [4]float64
+    for i, p := range parts {
+        if v[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64); err != nil {
+            return 0, 0, 0, 0, fmt.Errorf("bbox must contain numbers")
+        }
+    }
+    if v[0] >= v[2] || v[1] >= v[3] {
+        return 0, 0, 0, 0, fmt.Errorf("bbox minimums must be below maximums")
+    }
+    return v[0], v[1], v[2], v[3], nil
+}
+
+// GetFacilitiesGeoJSON returns the facilities of one type inside a bounding
+// box as a GeoJSON FeatureCollection
+func GetFacilitiesGeoJSON(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    facilityType, ok := config.FindFacilityType(q.Get("type"))
+    if !ok {
+        http.Error(w, "Unknown facility type", http.StatusBadRequest)
+        return
+    }
+    table := facilityType.Table
+
+    minLon, minLat, maxLon, maxLat, err := parseBBox(q.Get("bbox"))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    fields, err := facilityGeoLayer.selectFields(q.Get("fields"))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    limit := featureLimit(q.Get("limit"))
+
+    query := fmt.Sprintf(`
+        SELECT
+            NULLIF(trim(latitude::text), '')::float8 AS lat,
+            NULLIF(trim(longitude::text), '')::float8 AS lon
+            %s
+        FROM %s
+        WHERE NULLIF(trim(latitude::text), '') IS NOT NULL
+        AND NULLIF(trim(longitude::text), '') IS NOT NULL
+        AND NULLIF(trim(latitude::text), '')::float8 BETWEEN $1 AND $2
+        AND NULLIF(trim(longitude::text), '')::float8 BETWEEN $3 AND $4
+        LIMIT $5`, fieldColumns(fields), pq.QuoteIdentifier(table))
+
+    rows, err := config.DB.QueryContext(r.Context(), query, minLat, maxLat, minLon, maxLon, limit+1)
+    if err != nil {
+        log.Printf("Error querying %s features: %v", table, err)
+        http.Error(w, "Error fetching facilities", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    collection, err := scanFeatures(rows, fields, limit)
+    if err != nil {
+        log.Printf("Error scanning %s features: %v", table, err)
+        http.Error(w, "Error fetching facilities", http.StatusInternalServerError)
+        return
+    }
+
+    writeGeoJSON(w, collection)
+}
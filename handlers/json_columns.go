@@ -0,0 +1,310 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+    "village_site/config"
+    "village_site/models"
+    "village_site/utils"
+)
+
+// villageJSONColumns are the JSON text columns of villages with their typed
+// decoders
+var villageJSONColumns = []string{"colleges_near", "schools_near", "national_highways", "rivers"}
+
+// decodeJSONColumn decodes a JSON text column, treating blank and null
+// values as empty
+func decodeJSONColumn(raw string, v interface{}) error {
+    raw = strings.TrimSpace(raw)
+    if raw == "" || raw == "null" {
+        raw = "[]"
+    }
+    return json.Unmarshal([]byte(raw), v)
+}
+
+// decodeVillageJSONColumn decodes one of villageJSONColumns into its typed
+// slice
+func decodeVillageJSONColumn(column, raw string) (interface{}, error) {
+    var err error
+    switch column {
+    case "colleges_near":
+        var colleges []CollegeNear
+        err = decodeJSONColumn(raw, &colleges)
+        return colleges, err
+    case "schools_near":
+        var schools []SchoolNear
+        err = decodeJSONColumn(raw, &schools)
+        return schools, err
+    case "national_highways":
+        var highways []Highway
+        err = decodeJSONColumn(raw, &highways)
+        return highways, err
+    case "rivers":
+        var rivers []models.River
+        err = decodeJSONColumn(raw, &rivers)
+        return rivers, err
+    }
+    return nil, fmt.Errorf("unknown JSON column %q", column)
+}
+
+// fixRiverTranslations repairs double-encoded translations in place and
+// reports how many were changed
+func fixRiverTranslations(rivers []models.River) int {
+    fixed := 0
+    for i := range rivers {
+        for j, translation := range rivers[i].Translations {
+            if repaired, changed := utils.FixMojibake(translation); changed {
+                rivers[i].Translations[j] = repaired
+                fixed++
+            }
+        }
+    }
+    return fixed
+}
+
+// fixRawRiverTranslations repairs double-encoded translations in a stored
+// rivers value, keeping every other key and value as it was, and reports how
+// many were changed
+func fixRawRiverTranslations(raw string) (string, int, error) {
+    var rivers []map[string]interface{}
+    decoder := json.NewDecoder(strings.NewReader(raw))
+    decoder.UseNumber()
+    if err := decoder.Decode(&rivers); err != nil {
+        return raw, 0, err
+    }
+
+    fixed := 0
+    for _, river := range rivers {
+        translations, _ := river["translations"].([]interface{})
+        for j, translation := range translations {
+            text, ok := translation.(string)
+            if !ok {
+                continue
+            }
+            if repaired, changed := utils.FixMojibake(text); changed {
+                translations[j] = repaired
+                fixed++
+            }
+        }
+    }
+    if fixed == 0 {
+        return raw, 0, nil
+    }
+
+    var corrected strings.Builder
+    encoder := json.NewEncoder(&corrected)
+    encoder.SetEscapeHTML(false)
+    if err := encoder.Encode(rivers); err != nil {
+        return raw, 0, err
+    }
+    return strings.TrimSpace(corrected.String()), fixed, nil
+}
+
+type JSONColumnIssue struct {
+    State       string `json:"state"`
+    District    string `json:"district"`
+    Subdistrict string `json:"subdistrict"`
+    Locality    string `json:"locality"`
+    Column      string `json:"column"`
+    Kind        string `json:"kind"` // "malformed" or "mojibake"
+    Detail      string `json:"detail"`
+    Value       string `json:"value"`
+}
+
+type JSONValidationReport struct {
+    Scanned       int               `json:"scanned"`
+    Malformed     map[string]int    `json:"malformed"`
+    MojibakeRows  int               `json:"mojibake_rows"`
+    MojibakeTexts int               `json:"mojibake_translations"`
+    Fixed         int               `json:"fixed"`
+    Fix           bool              `json:"fix"`
+    Issues        []JSONColumnIssue `json:"issues"`
+}
+
+type JSONValidationOptions struct {
+    State     string
+    Fix       bool
+    MaxIssues int
+}
+
+type riversFix struct {
+    ctid     string
+    original string
+    fixed    string
+}
+
+// jsonFixBatchSize is how many corrected rows are written per transaction
+const jsonFixBatchSize = 1000
+
+// ValidateVillageJSON scans the JSON columns of every village (optionally of
+// one state), reporting values that do not decode into their typed structs
+// and river translations that are double-encoded UTF-8. With Fix set, the
+// repaired rivers values are written back in batched transactions; a row is
+// only updated if it still holds the value that was scanned.
+func ValidateVillageJSON(ctx context.Context, opts JSONValidationOptions) (*JSONValidationReport, error) {
+    if opts.MaxIssues <= 0 {
+        opts.MaxIssues = 200
+    }
+
+    report := &JSONValidationReport{
+        Malformed: make(map[string]int),
+        Fix:       opts.Fix,
+        Issues:    make([]JSONColumnIssue, 0),
+    }
+    for _, column := range villageJSONColumns {
+        report.Malformed[column] = 0
+    }
+
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT
+            ctid::text,
+            COALESCE(state, ''),
+            COALESCE(district, ''),
+            COALESCE(subdistrict, ''),
+            COALESCE(locality, village_name, ''),
+            COALESCE(colleges_near::text, ''),
+            COALESCE(schools_near::text, ''),
+            COALESCE(national_highways::text, ''),
+            COALESCE(rivers::text, '')
+        FROM villages
+        WHERE ($1 = '' OR LOWER(state) = LOWER($1))`, opts.State)
+    if err != nil {
+        return nil, fmt.Errorf("error scanning villages: %v", err)
+    }
+    defer rows.Close()
+
+    addIssue := func(issue JSONColumnIssue) {
+        if len(report.Issues) < opts.MaxIssues {
+            if len(issue.Value) > 300 {
+                issue.Value = issue.Value[:300] + "..."
+            }
+            report.Issues = append(report.Issues, issue)
+        }
+    }
+
+    var pending []riversFix
+    flush := func() error {
+        if len(pending) == 0 {
+            return nil
+        }
+        updated, err := applyRiversFixes(ctx, pending)
+        report.Fixed += updated
+        pending = pending[:0]
+        return err
+    }
+
+    for rows.Next() {
+        var ctid string
+        var issue JSONColumnIssue
+        values := make([]string, len(villageJSONColumns))
+        if err := rows.Scan(&ctid, &issue.State, &issue.District, &issue.Subdistrict, &issue.Locality,
+            &values[0], &values[1], &values[2], &values[3]); err != nil {
+            return report, fmt.Errorf("error reading village row: %v", err)
+        }
+        report.Scanned++
+
+        for i, column := range villageJSONColumns {
+            decoded, err := decodeVillageJSONColumn(column, values[i])
+            if err != nil {
+                report.Malformed[column]++
+                issue.Column, issue.Kind, issue.Detail, issue.Value = column, "malformed", err.Error(), values[i]
+                addIssue(issue)
+                continue
+            }
+
+            if _, ok := decoded.([]models.River); !ok || strings.TrimSpace(values[i]) == "" {
+                continue
+            }
+            // the repair works on the stored JSON, so keys the model does
+            // not know survive it
+            corrected, fixed, err := fixRawRiverTranslations(values[i])
+            if err != nil {
+                return report, fmt.Errorf("error correcting rivers: %v", err)
+            }
+            if fixed == 0 {
+                continue
+            }
+
+            report.MojibakeRows++
+            report.MojibakeTexts += fixed
+            issue.Column, issue.Kind, issue.Value = column, "mojibake", values[i]
+            issue.Detail = fmt.Sprintf("%d double-encoded translation(s); corrected: %s", fixed, corrected)
+            addIssue(issue)
+
+            if opts.Fix {
+                pending = append(pending, riversFix{ctid: ctid, original: values[i], fixed: corrected})
+                if len(pending) >= jsonFixBatchSize {
+                    if err := flush(); err != nil {
+                        return report, err
+                    }
+                }
+            }
+        }
+    }
+
+    if err := rows.Err(); err != nil {
+        return report, fmt.Errorf("error scanning villages: %v", err)
+    }
+    if err := flush(); err != nil {
+        return report, err
+    }
+
+    return report, nil
+}
+
+func applyRiversFixes(ctx context.Context, fixes []riversFix) (int, error) {
+    updated := 0
+    err := config.WithTransaction(ctx, func(tx *sql.Tx) error {
+        updated = 0
+        stmt, err := tx.PrepareContext(ctx, `
+            UPDATE villages
+            SET rivers = $1
+            WHERE ctid = $2::tid
+            AND rivers::text = $3`)
+        if err != nil {
+            return err
+        }
+        defer stmt.Close()
+
+        for _, fix := range fixes {
+            result, err := stmt.ExecContext(ctx, fix.fixed, fix.ctid, fix.original)
+            if err != nil {
+                return fmt.Errorf("error updating rivers at %s: %v", fix.ctid, err)
+            }
+            if n, _ := result.RowsAffected(); n > 0 {
+                updated++
+            }
+        }
+        return nil
+    })
+    return updated, err
+}
+
+// ValidateVillageJSONHandler reports malformed village JSON columns. A POST
+// with fix=true also writes corrected rivers values back.
+func ValidateVillageJSONHandler(w http.ResponseWriter, r *http.Request) {
+    opts := JSONValidationOptions{
+        State: strings.TrimSpace(r.URL.Query().Get("state")),
+        Fix:   r.Method == http.MethodPost && r.URL.Query().Get("fix") == "true",
+    }
+    fmt.Sscan(r.URL.Query().Get("max_issues"), &opts.MaxIssues)
+
+    // A full scan takes longer than the server's WriteTimeout
+    http.NewResponseController(w).SetWriteDeadline(time.Now().Add(30 * time.Minute))
+
+    report, err := ValidateVillageJSON(r.Context(), opts)
+    if err != nil {
+        log.Printf("Error validating village JSON: %v", err)
+        http.Error(w, "Error validating village JSON columns", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(report)
+}
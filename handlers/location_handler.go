@@ -271,6 +271,21 @@ func SearchLocations(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    filter := `
+            state ILIKE $1 OR 
+            district ILIKE $1 OR 
+            subdistrict ILIKE $1 OR 
+            locality ILIKE $1`
+    args := []interface{}{"%" + req.Query + "%"}
+
+    native, err := resolveNativeQuery(r.Context(), req.Query)
+    if err != nil {
+        log.Printf("Error resolving search query %q: %v", req.Query, err)
+    }
+    if !native.empty() {
+        filter, args = nativeSearchCondition(native, 1)
+    }
+
     rows, err := config.DB.Query(`
         SELECT DISTINCT 
             state, 
@@ -278,13 +293,9 @@ func SearchLocations(w http.ResponseWriter, r *http.Request) {
             subdistrict, 
             locality
         FROM villages
-        WHERE 
-            state ILIKE $1 OR 
-            district ILIKE $1 OR 
-            subdistrict ILIKE $1 OR 
-            locality ILIKE $1
+        WHERE `+filter+`
         LIMIT 10`,
-        "%"+req.Query+"%")
+        args...)
     
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -1,20 +1,30 @@
 package handlers
 
 import (
+    "context"
     "encoding/json"
     "fmt"
     "log"
+    "math"
     "net/http"
+    "strings"
     "sync" // Add this import
     "village_site/config"
+    "village_site/models"
     "village_site/utils"
     "database/sql"
-    // Remove models import since it's not being used
+
+    "github.com/lib/pq"
 )
 
 type MandalRequest struct {
     District    string `json:"district"`
     Subdistrict string `json:"subdistrict"`
+    // Paging of the villages list; see VillagePage
+    VillageSort  string `json:"village_sort"`
+    VillageOrder string `json:"village_order"`
+    VillagePage  int    `json:"village_page"`
+    VillageLimit int    `json:"village_limit"`
 }
 
 type MandalDistanceRequest struct {
@@ -59,25 +69,6 @@ type Village struct {
     RoadConnectivity string  `json:"road_connectivity"`
 }
 
-type NearbyFacilities struct {
-    ATMs            []Facility `json:"atms"`
-    BusStops        []Facility `json:"bus_stops"`
-    Cinemas         []Facility `json:"cinemas"`
-    Colleges        []Facility `json:"colleges"`
-    Electronics     []Facility `json:"electronics"`
-    Government      []Facility `json:"government"`
-    Hospitals       []Facility `json:"hospitals"`
-    Hotels          []Facility `json:"hotels"`
-    Mosques         []Facility `json:"mosques"`
-    Parks           []Facility `json:"parks"`
-    PetrolPumps     []Facility `json:"petrol_pumps"`
-    PoliceStations  []Facility `json:"police_stations"`
-    Restaurants     []Facility `json:"restaurants"`
-    Schools         []Facility `json:"schools"`
-    Supermarkets    []Facility `json:"supermarkets"`
-    Temples         []Facility `json:"temples"`
-}
-
 type MandalDetails struct {
     BasicInfo struct {
         Latitude           float64 `json:"latitude"`
@@ -115,22 +106,37 @@ type MandalDetails struct {
         PopulationMales  int     `json:"population_males"`
         PopulationFemales int    `json:"population_females"`
         HousesCount      int     `json:"houses_count"`
+        Pincodes         []models.Pincode      `json:"pincodes"`
+        Colleges         []models.College      `json:"colleges"`
+        Rivers           []models.River        `json:"rivers"`
+        TouristPlaces    []models.TouristPlace `json:"tourist_places"`
+        Companies        []models.Company      `json:"companies"`
         District         string  `json:"district"`
         Subdistrict      string  `json:"subdistrict"`
     } `json:"basic_info"`
 
     Villages         []Village         `json:"villages"`
-    Facilities       NearbyFacilities  `json:"facilities"`
+    VillagesPage     *VillagePage      `json:"villages_page,omitempty"`
+    // Facilities is keyed by each facility type's mandal key
+    Facilities       map[string][]Facility `json:"facilities"`
+    // FacilityCounts holds the full counts per facility type, from the
+    // facility summary
+    FacilityCounts   *FacilityAreaSummary  `json:"facility_counts,omitempty"`
 }
 
 type TravelInfo struct {
     Distance     float64                  `json:"distance"`
+    // RoadDistance is the straight-line distance times the road circuity
+    // factor
+    RoadDistance float64                  `json:"road_distance"`
     TravelTimes  map[string]FormattedTime `json:"travel_times"`
     RouteDetails struct {
         MainRoads    []string `json:"main_roads"`
         Landmarks    []string `json:"landmarks"`
         Interchanges []string `json:"interchanges"`
     } `json:"route_details"`
+    Rail         RailTravel               `json:"rail"`
+    Bus          BusTravel                `json:"bus"`
 }
 
 type MandalDistanceResponse struct {
@@ -140,11 +146,19 @@ type MandalDistanceResponse struct {
 }
 
 type DistrictSuggestion struct {
-    District string `json:"district"`
+    District string  `json:"district"`
+    Score    float64 `json:"score"`
 }
 
+// SubdistrictSuggestion is a canonical subdistrict name. When the query
+// matched one of its alternate names, Matched is that name and Alias its
+// kind (mandal, city, tehsil, block, taluk or taluka).
 type SubdistrictSuggestion struct {
-    Subdistrict string `json:"subdistrict"`
+    Subdistrict string  `json:"subdistrict"`
+    District    string  `json:"district"`
+    Matched     string  `json:"matched,omitempty"`
+    Alias       string  `json:"alias,omitempty"`
+    Score       float64 `json:"score"`
 }
 
 func formatTime(decimalHours float64) FormattedTime {
@@ -179,37 +193,30 @@ func formatTime(decimalHours float64) FormattedTime {
 }
 
 func initializeMandalDetails() MandalDetails {
-    return MandalDetails{
-        Villages: []Village{},
-        Facilities: NearbyFacilities{
-            ATMs:           []Facility{},
-            BusStops:       []Facility{},
-            Cinemas:        []Facility{},
-            Colleges:       []Facility{},
-            Electronics:    []Facility{},
-            Government:     []Facility{},
-            Hospitals:      []Facility{},
-            Hotels:         []Facility{},
-            Mosques:        []Facility{},
-            Parks:          []Facility{},
-            PetrolPumps:    []Facility{},
-            PoliceStations: []Facility{},
-            Restaurants:    []Facility{},
-            Schools:        []Facility{},
-            Supermarkets:   []Facility{},
-            Temples:        []Facility{},
-        },
+    details := MandalDetails{
+        Villages:   []Village{},
+        Facilities: make(map[string][]Facility),
     }
+    for _, facilityType := range config.FacilityTypes() {
+        details.Facilities[facilityType.MandalKey] = []Facility{}
+    }
+    return details
 }
 
-func calculateTravelTimes(distance float64) map[string]FormattedTime {
-    return map[string]FormattedTime{
-        "bus":   formatTime(distance / 40),  // 40 km/h average speed
-        "train": formatTime(distance / 60),  // 60 km/h average speed
-        "car":   formatTime(distance / 50),  // 50 km/h average speed
-        "bike":  formatTime(distance / 45),  // 45 km/h average speed
-        "auto":  formatTime(distance / 35),  // 35 km/h average speed
+// calculateTravelTimes estimates the time to cover a straight-line distance
+// by road with each travel mode, at the speeds configured for the state
+func calculateTravelTimes(distance float64, state string) map[string]FormattedTime {
+    times := make(map[string]FormattedTime)
+    for mode, speed := range config.TravelSpeeds(state) {
+        times[mode] = formatTime(roadDistance(distance) / speed)
     }
+    return times
+}
+
+// roadDistance converts a straight-line distance into the distance travelled
+// by road, which is longer by the circuity factor
+func roadDistance(distance float64) float64 {
+    return distance * config.RoadCircuityFactor()
 }
 
 func GetMandalDetails(w http.ResponseWriter, r *http.Request) {
@@ -229,7 +236,10 @@ func GetMandalDetails(w http.ResponseWriter, r *http.Request) {
 
     mandalDetails := initializeMandalDetails()
 
-    if err := getMandaBasicInfo(&mandalDetails, req.District, req.Subdistrict); err != nil {
+    if err := getMandaBasicInfo(&mandalDetails, req.District, req.Subdistrict); err == sql.ErrNoRows {
+        http.Error(w, "Mandal not found", http.StatusNotFound)
+        return
+    } else if err != nil {
         log.Printf("Error fetching basic mandal info: %v", err)
         http.Error(w, "Error fetching mandal details", http.StatusInternalServerError)
         return
@@ -240,10 +250,44 @@ func GetMandalDetails(w http.ResponseWriter, r *http.Request) {
         // Continue with partial data
     }
 
+    villagePage := VillagePage{Sort: req.VillageSort, Order: req.VillageOrder, Page: req.VillagePage, Limit: req.VillageLimit}
+    if err := getMandalVillages(r.Context(), &mandalDetails, req.District, req.Subdistrict, villagePage); err != nil {
+        log.Printf("Error fetching mandal villages: %v", err)
+    }
+
+    // a mandal's name may recur in another state; its own counts are those
+    // of its state, or the only ones there are
+    state := strings.ToLower(mandalState(r.Context(), req.District, req.Subdistrict))
+    if summaries, err := getFacilitySummaries(r.Context(), "subdistrict", "", req.District, req.Subdistrict); err != nil {
+        log.Printf("Error fetching facility counts: %v", err)
+    } else {
+        for i := range summaries {
+            if summaries[i].State == state || len(summaries) == 1 {
+                mandalDetails.FacilityCounts = &summaries[i]
+                break
+            }
+        }
+    }
+
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(mandalDetails)
 }
 
+// mandalState returns the state of a mandal, taken from its villages as the
+// mandals table has none, or "" when unknown
+func mandalState(ctx context.Context, district, subdistrict string) string {
+    var state string
+    err := config.DB.QueryRowContext(ctx, `
+        SELECT COALESCE(MIN(trim(state)), '')
+        FROM villages
+        WHERE LOWER(trim(district)) = LOWER(trim($1)) AND LOWER(trim(subdistrict)) = LOWER(trim($2))
+        AND NULLIF(trim(state), '') IS NOT NULL`, district, subdistrict).Scan(&state)
+    if err != nil {
+        log.Printf("Error fetching mandal state: %v", err)
+    }
+    return state
+}
+
 func GetMandalDistance(w http.ResponseWriter, r *http.Request) {
     var req MandalDistanceRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -265,17 +309,23 @@ func GetMandalDistance(w http.ResponseWriter, r *http.Request) {
     toMandal := initializeMandalDetails()
 
     // Get source mandal details
-    if err := getMandaBasicInfo(&fromMandal, req.FromDistrict, req.FromSubdistrict); err != nil {
-        log.Printf("Error fetching source mandal: %v", err)
+    if err := getMandaBasicInfo(&fromMandal, req.FromDistrict, req.FromSubdistrict); err == sql.ErrNoRows {
         http.Error(w, "Source mandal not found", http.StatusNotFound)
         return
+    } else if err != nil {
+        log.Printf("Error fetching source mandal: %v", err)
+        http.Error(w, "Error fetching mandal details", http.StatusInternalServerError)
+        return
     }
 
     // Get destination mandal details
-    if err := getMandaBasicInfo(&toMandal, req.ToDistrict, req.ToSubdistrict); err != nil {
-        log.Printf("Error fetching destination mandal: %v", err)
+    if err := getMandaBasicInfo(&toMandal, req.ToDistrict, req.ToSubdistrict); err == sql.ErrNoRows {
         http.Error(w, "Destination mandal not found", http.StatusNotFound)
         return
+    } else if err != nil {
+        log.Printf("Error fetching destination mandal: %v", err)
+        http.Error(w, "Error fetching mandal details", http.StatusInternalServerError)
+        return
     }
 
     // Calculate distance using mandal coordinates
@@ -287,7 +337,15 @@ func GetMandalDistance(w http.ResponseWriter, r *http.Request) {
     )
 
     response.TravelInfo.Distance = distance
-    response.TravelInfo.TravelTimes = calculateTravelTimes(distance)
+    response.TravelInfo.RoadDistance = math.Round(roadDistance(distance)*100) / 100
+    // travel times use the speeds of the state the journey starts in
+    response.TravelInfo.TravelTimes = calculateTravelTimes(distance,
+        mandalState(r.Context(), req.FromDistrict, req.FromSubdistrict))
+    if err := fillRouteDetails(r.Context(), &response.TravelInfo, &fromMandal, &toMandal); err != nil {
+        log.Printf("Error inferring route details: %v", err)
+    }
+    response.TravelInfo.Rail = findRailOptions(r.Context(), &fromMandal, &toMandal)
+    response.TravelInfo.Bus = findBusOptions(r.Context(), &fromMandal, &toMandal)
 
     // Get facilities for both mandals
     log.Printf("Fetching facilities for source mandal: %s, %s", req.FromDistrict, req.FromSubdistrict)
@@ -307,13 +365,22 @@ func GetMandalDistance(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(response)
 }
 
+// mandalNumber reads a numeric mandals column that may be stored as text
+// with separators or units, e.g. "1,234" or "512 m". The first number in the
+// text is used, so "300-400 m" reads as 300; text without one reads as 0.
+func mandalNumber(column string) string {
+    return fmt.Sprintf(`COALESCE(substring(replace(%s::text, ',', '') from '-?[0-9]+(?:\.[0-9]+)?')::float8, 0)`, column)
+}
+
+// getMandaBasicInfo loads the mandals row of a subdistrict into
+// mandalDetails.BasicInfo. A missing mandal is reported as sql.ErrNoRows.
 func getMandaBasicInfo(mandalDetails *MandalDetails, district, subdistrict string) error {
-    query := `
+    query := fmt.Sprintf(`
         SELECT 
-            COALESCE(latitude::float8, 0.0), 
-            COALESCE(longitude::float8, 0.0), 
+            COALESCE(NULLIF(trim(latitude::text), '')::float8, 0),
+            COALESCE(NULLIF(trim(longitude::text), '')::float8, 0),
             COALESCE(language, ''),
-            COALESCE(elevation_altitude::float8, 0.0),
+            %s,
             COALESCE(telephone_std_code, ''),
             COALESCE(vehicle_registration, ''),
             COALESCE(rto_office, ''),
@@ -331,9 +398,9 @@ func getMandaBasicInfo(mandalDetails *MandalDetails, district, subdistrict strin
             COALESCE(headquarters, ''),
             COALESCE(region, ''),
             COALESCE(nearby_cities, ''),
-            COALESCE(villages_count::integer, 0),
-            COALESCE(panchayats_count::integer, 0),
-            COALESCE(elevation::float8, 0.0),
+            %s::integer,
+            %s::integer,
+            %s,
             COALESCE(languages, ''),
             COALESCE(political_parties, ''),
             COALESCE(current_mla, ''),
@@ -341,63 +408,107 @@ func getMandaBasicInfo(mandalDetails *MandalDetails, district, subdistrict strin
             COALESCE(parliament_constituency, ''),
             COALESCE(smallest_village, ''),
             COALESCE(biggest_village, ''),
-            COALESCE(population_total::integer, 0),
-            COALESCE(population_males::integer, 0),
-            COALESCE(population_females::integer, 0),
-            COALESCE(houses_count::integer, 0)
+            %s::bigint,
+            %s::bigint,
+            %s::bigint,
+            %s::bigint,
+            COALESCE(pincodes::text, ''),
+            COALESCE(colleges::text, ''),
+            COALESCE(rivers::text, ''),
+            COALESCE(tourist_places::text, ''),
+            COALESCE(companies::text, ''),
+            district,
+            subdistrict
         FROM mandals
-        WHERE LOWER(district) = LOWER($1) AND LOWER(subdistrict) = LOWER($2)`
-
+        WHERE LOWER(district) = LOWER($1) AND LOWER(subdistrict) = LOWER($2)
+        LIMIT 1`,
+        mandalNumber("elevation_altitude"), mandalNumber("villages_count"), mandalNumber("panchayats_count"),
+        mandalNumber("elevation"), mandalNumber("population_total"), mandalNumber("population_males"),
+        mandalNumber("population_females"), mandalNumber("houses_count"))
+
+    info := &mandalDetails.BasicInfo
+    var pincodesJSON, collegesJSON, riversJSON, touristPlacesJSON, companiesJSON string
     err := config.DB.QueryRow(query, district, subdistrict).Scan(
-        &mandalDetails.BasicInfo.Latitude,
-        &mandalDetails.BasicInfo.Longitude,
-        &mandalDetails.BasicInfo.Language,
-        &mandalDetails.BasicInfo.ElevationAltitude,
-        &mandalDetails.BasicInfo.TelephoneCode,
-        &mandalDetails.BasicInfo.VehicleReg,
-        &mandalDetails.BasicInfo.RTOOffice,
-        &mandalDetails.BasicInfo.AssemblyConst,
-        &mandalDetails.BasicInfo.AssemblyMLA,
-        &mandalDetails.BasicInfo.LokSabha,
-        &mandalDetails.BasicInfo.ParliamentMP,
-        &mandalDetails.BasicInfo.AlternateMandal,
-        &mandalDetails.BasicInfo.AlternateCity,
-        &mandalDetails.BasicInfo.AlternateTehsil,
-        &mandalDetails.BasicInfo.AlternateBlock,
-        &mandalDetails.BasicInfo.AlternateTaluk,
-        &mandalDetails.BasicInfo.AlternateTaluka,
-        &mandalDetails.BasicInfo.AdminType,
-        &mandalDetails.BasicInfo.Headquarters,
-        &mandalDetails.BasicInfo.Region,
-        &mandalDetails.BasicInfo.NearbyCities,
-        &mandalDetails.BasicInfo.VillagesCount,
-        &mandalDetails.BasicInfo.PanchayatsCount,
-        &mandalDetails.BasicInfo.Elevation,
-        &mandalDetails.BasicInfo.Languages,
-        &mandalDetails.BasicInfo.PoliticalParties,
-        &mandalDetails.BasicInfo.CurrentMLA,
-        &mandalDetails.BasicInfo.MLAParty,
-        &mandalDetails.BasicInfo.ParliamentConst,
-        &mandalDetails.BasicInfo.SmallestVillage,
-        &mandalDetails.BasicInfo.BiggestVillage,
-        &mandalDetails.BasicInfo.PopulationTotal,
-        &mandalDetails.BasicInfo.PopulationMales,
-        &mandalDetails.BasicInfo.PopulationFemales,
-        &mandalDetails.BasicInfo.HousesCount,
+        &info.Latitude,
+        &info.Longitude,
+        &info.Language,
+        &info.ElevationAltitude,
+        &info.TelephoneCode,
+        &info.VehicleReg,
+        &info.RTOOffice,
+        &info.AssemblyConst,
+        &info.AssemblyMLA,
+        &info.LokSabha,
+        &info.ParliamentMP,
+        &info.AlternateMandal,
+        &info.AlternateCity,
+        &info.AlternateTehsil,
+        &info.AlternateBlock,
+        &info.AlternateTaluk,
+        &info.AlternateTaluka,
+        &info.AdminType,
+        &info.Headquarters,
+        &info.Region,
+        &info.NearbyCities,
+        &info.VillagesCount,
+        &info.PanchayatsCount,
+        &info.Elevation,
+        &info.Languages,
+        &info.PoliticalParties,
+        &info.CurrentMLA,
+        &info.MLAParty,
+        &info.ParliamentConst,
+        &info.SmallestVillage,
+        &info.BiggestVillage,
+        &info.PopulationTotal,
+        &info.PopulationMales,
+        &info.PopulationFemales,
+        &info.HousesCount,
+        &pincodesJSON,
+        &collegesJSON,
+        &riversJSON,
+        &touristPlacesJSON,
+        &companiesJSON,
+        &info.District,
+        &info.Subdistrict,
     )
-
+    if err == sql.ErrNoRows {
+        return err
+    }
     if err != nil {
         return fmt.Errorf("database query error: %v", err)
     }
 
-    mandalDetails.BasicInfo.District = district
-    mandalDetails.BasicInfo.Subdistrict = subdistrict
+    // Malformed JSON columns are logged and left empty rather than failing
+    // the whole profile
+    info.Pincodes = []models.Pincode{}
+    info.Colleges = []models.College{}
+    info.Rivers = []models.River{}
+    info.TouristPlaces = []models.TouristPlace{}
+    info.Companies = []models.Company{}
+    for _, column := range []struct {
+        name string
+        raw  string
+        dest interface{}
+    }{
+        {"pincodes", pincodesJSON, &info.Pincodes},
+        {"colleges", collegesJSON, &info.Colleges},
+        {"rivers", riversJSON, &info.Rivers},
+        {"tourist_places", touristPlacesJSON, &info.TouristPlaces},
+        {"companies", companiesJSON, &info.Companies},
+    } {
+        if err := decodeJSONColumn(column.raw, column.dest); err != nil {
+            log.Printf("Error parsing mandal %s for %s, %s: %v", column.name, district, subdistrict, err)
+        }
+    }
+    fixRiverTranslations(info.Rivers)
 
     return nil
 }
 
 func getFacilities(mandalDetails *MandalDetails, district, subdistrict string) error {
     queryFacilities := func(tableName string) ([]Facility, error) {
+        tableName = pq.QuoteIdentifier(tableName)
         query := fmt.Sprintf(`
             WITH mandal_center AS (
                 SELECT latitude, longitude 
@@ -465,43 +576,29 @@ func getFacilities(mandalDetails *MandalDetails, district, subdistrict string) e
         return facilities, nil
     }
 
-    // Map of facility types to their corresponding slice pointers
-    facilityTypes := map[string]*[]Facility{
-        "atm":            &mandalDetails.Facilities.ATMs,
-        "bus_stop":       &mandalDetails.Facilities.BusStops,
-        "cinema":         &mandalDetails.Facilities.Cinemas,
-        "college":        &mandalDetails.Facilities.Colleges,
-        "electronic":     &mandalDetails.Facilities.Electronics,
-        "government":     &mandalDetails.Facilities.Government,
-        "hospitals":      &mandalDetails.Facilities.Hospitals,
-        "hotel":         &mandalDetails.Facilities.Hotels,
-        "mosque":        &mandalDetails.Facilities.Mosques,
-        "park":          &mandalDetails.Facilities.Parks,
-        "petrol_pump":   &mandalDetails.Facilities.PetrolPumps,
-        "police_station": &mandalDetails.Facilities.PoliceStations,
-        "restaurant":    &mandalDetails.Facilities.Restaurants,
-        "school":        &mandalDetails.Facilities.Schools,
-        "supermarket":   &mandalDetails.Facilities.Supermarkets,
-        "temples":       &mandalDetails.Facilities.Temples,
-    }
-
     // Query each facility type concurrently using goroutines
     var wg sync.WaitGroup
+    var mutex sync.Mutex
+    facilityTypes := config.FacilityTypes()
     errChan := make(chan error, len(facilityTypes))
 
-    for tableName, facilitySlice := range facilityTypes {
+    for _, facilityType := range facilityTypes {
         wg.Add(1)
-        go func(table string, slice *[]Facility) {
+        go func(facilityType models.FacilityType) {
             defer wg.Done()
-            facilities, err := queryFacilities(table)
+            facilities, err := queryFacilities(facilityType.Table)
             if err != nil {
-                log.Printf("Error fetching %s: %v", table, err)
-                *slice = []Facility{}
+                log.Printf("Error fetching %s: %v", facilityType.Table, err)
                 errChan <- err
                 return
             }
-            *slice = facilities
-        }(tableName, facilitySlice)
+            if facilities == nil {
+                facilities = []Facility{}
+            }
+            mutex.Lock()
+            mandalDetails.Facilities[facilityType.MandalKey] = facilities
+            mutex.Unlock()
+        }(facilityType)
     }
 
     // Wait for all goroutines to complete
@@ -521,7 +618,8 @@ func getFacilities(mandalDetails *MandalDetails, district, subdistrict string) e
     return nil
 }
 
-// Add these new handler functions
+// GetDistrictSuggestions suggests districts for a partly typed or
+// misspelled name
 func GetDistrictSuggestions(w http.ResponseWriter, r *http.Request) {
     searchTerm := r.URL.Query().Get("q")
     if searchTerm == "" {
@@ -529,29 +627,25 @@ func GetDistrictSuggestions(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    query := `
-        SELECT DISTINCT district 
-        FROM mandals 
-        WHERE LOWER(district) LIKE LOWER($1 || '%')
-        ORDER BY district
-        LIMIT 10`
-
-    rows, err := config.DB.Query(query, searchTerm)
+    names, err := loadMandalNames(r.Context())
     if err != nil {
-        log.Printf("Error querying districts: %v", err)
+        log.Printf("Error loading mandal names: %v", err)
         http.Error(w, "Error fetching suggestions", http.StatusInternalServerError)
         return
     }
-    defer rows.Close()
 
-    var suggestions []DistrictSuggestion
-    for rows.Next() {
-        var district string
-        if err := rows.Scan(&district); err != nil {
-            log.Printf("Error scanning district: %v", err)
-            continue
+    districts := make([]mandalName, 0)
+    seen := make(map[string]bool)
+    for _, name := range names {
+        if !seen[name.District] {
+            seen[name.District] = true
+            districts = append(districts, newMandalName(name.District, "", name.District, ""))
         }
-        suggestions = append(suggestions, DistrictSuggestion{District: district})
+    }
+
+    suggestions := make([]DistrictSuggestion, 0)
+    for _, s := range rankSuggestions(searchTerm, districts, func(n mandalName) string { return n.District }) {
+        suggestions = append(suggestions, DistrictSuggestion{District: s.name.District, Score: roundScore(s.score)})
     }
 
     w.Header().Set("Content-Type", "application/json")
@@ -560,57 +654,56 @@ func GetDistrictSuggestions(w http.ResponseWriter, r *http.Request) {
     })
 }
 
+// GetSubdistrictSuggestions suggests subdistricts by their own or alternate
+// names. With a district, suggestions are limited to it; without a query,
+// the district's subdistricts are listed.
 func GetSubdistrictSuggestions(w http.ResponseWriter, r *http.Request) {
     searchTerm := r.URL.Query().Get("q")
     district := r.URL.Query().Get("district")
-    
-    if district == "" {
-        http.Error(w, "District is required", http.StatusBadRequest)
-        return
-    }
-
-    var query string
-    var rows *sql.Rows
-    var err error
 
-    if searchTerm != "" {
-        query = `
-            SELECT DISTINCT subdistrict 
-            FROM mandals 
-            WHERE LOWER(district) = LOWER($1)
-            AND LOWER(subdistrict) LIKE LOWER($2 || '%')
-            ORDER BY subdistrict
-            LIMIT 10`
-        rows, err = config.DB.Query(query, district, searchTerm)
-    } else {
-        query = `
-            SELECT DISTINCT subdistrict 
-            FROM mandals 
-            WHERE LOWER(district) = LOWER($1)
-            ORDER BY subdistrict
-            LIMIT 10`
-        rows, err = config.DB.Query(query, district)
+    if district == "" && searchTerm == "" {
+        http.Error(w, "District or search term is required", http.StatusBadRequest)
+        return
     }
 
+    names, err := loadMandalNames(r.Context())
     if err != nil {
-        log.Printf("Error querying subdistricts: %v", err)
+        log.Printf("Error loading mandal names: %v", err)
         http.Error(w, "Error fetching suggestions", http.StatusInternalServerError)
         return
     }
-    defer rows.Close()
 
-    var suggestions []SubdistrictSuggestion
-    for rows.Next() {
-        var subdistrict string
-        if err := rows.Scan(&subdistrict); err != nil {
-            log.Printf("Error scanning subdistrict: %v", err)
-            continue
+    if district != "" {
+        canonical := matchDistrict(district, names)
+        filtered := make([]mandalName, 0)
+        for _, name := range names {
+            if canonical != "" && name.District == canonical && (searchTerm != "" || name.Kind == "") {
+                filtered = append(filtered, name)
+            }
+        }
+        names = filtered
+    }
+
+    suggestions := make([]SubdistrictSuggestion, 0)
+    key := func(n mandalName) string { return strings.ToLower(n.District + "\x00" + n.Subdistrict) }
+    for _, s := range rankSuggestions(searchTerm, names, key) {
+        suggestion := SubdistrictSuggestion{
+            Subdistrict: s.name.Subdistrict,
+            District:    s.name.District,
+            Score:       roundScore(s.score),
+        }
+        if s.name.Kind != "" {
+            suggestion.Matched, suggestion.Alias = s.name.Name, s.name.Kind
         }
-        suggestions = append(suggestions, SubdistrictSuggestion{Subdistrict: subdistrict})
+        suggestions = append(suggestions, suggestion)
     }
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]interface{}{
         "suggestions": suggestions,
     })
-}
\ No newline at end of file
+}
+
+func roundScore(score float64) float64 {
+    return math.Round(score*1000) / 1000
+}
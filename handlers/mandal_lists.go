@@ -0,0 +1,212 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "village_site/config"
+    "village_site/utils"
+
+    "github.com/lib/pq"
+)
+
+// mandalList describes a table indexing one JSON list column of mandals,
+// such as tourist_places or companies. Each named item becomes a row with
+// its mandal's state, district, subdistrict and coordinates, its name and
+// search key, and the values of Columns.
+type mandalList struct {
+    Table   string // the table rebuilt, named after the mandals column it reads
+    Label   string // used in errors, e.g. "tourist places"
+    Columns []string
+    // Decode reads one mandal's JSON list into its items
+    Decode func(raw string) ([]mandalListItem, error)
+}
+
+// mandalListItem is one item of a mandal's list, with the values of the
+// list's Columns
+type mandalListItem struct {
+    Name   string
+    Values []interface{}
+}
+
+// rebuildMandalList replaces the rows of l.Table with the items of every
+// mandal. Mandals without a district or subdistrict, items without a name,
+// and repeats within a mandal are skipped. The mandals table has no state, so
+// it is taken from the mandal's villages.
+func rebuildMandalList(ctx context.Context, l mandalList) error {
+    rows, err := config.DB.QueryContext(ctx, fmt.Sprintf(`
+        SELECT %[2]s, m.district, m.subdistrict,
+            NULLIF(trim(m.latitude::text), '')::float8,
+            NULLIF(trim(m.longitude::text), '')::float8,
+            m.%[1]s::text
+        FROM mandals m
+        WHERE NULLIF(trim(m.%[1]s::text), '') IS NOT NULL
+        AND NULLIF(trim(m.district), '') IS NOT NULL AND NULLIF(trim(m.subdistrict), '') IS NOT NULL`,
+        pq.QuoteIdentifier(l.Table), mandalStateSQL("m")))
+    if err != nil {
+        return fmt.Errorf("error reading mandal %s: %v", l.Label, err)
+    }
+
+    type entry struct {
+        state, district, subdistrict string
+        lat, lon              sql.NullFloat64
+        item                  mandalListItem
+    }
+    var entries []entry
+    seen := make(map[string]bool)
+    for rows.Next() {
+        var state, district, subdistrict, raw string
+        var lat, lon sql.NullFloat64
+        if err := rows.Scan(&state, &district, &subdistrict, &lat, &lon, &raw); err != nil {
+            rows.Close()
+            return fmt.Errorf("error reading mandal %s: %v", l.Label, err)
+        }
+        if lat.Float64 == 0 || lon.Float64 == 0 {
+            lat.Valid, lon.Valid = false, false
+        }
+        items, err := l.Decode(raw)
+        if err != nil {
+            continue
+        }
+        for _, item := range items {
+            item.Name = strings.TrimSpace(item.Name)
+            key := strings.ToLower(state + "\x00" + district + "\x00" + subdistrict + "\x00" + item.Name)
+            if item.Name == "" || seen[key] {
+                continue
+            }
+            seen[key] = true
+            entries = append(entries, entry{state, district, subdistrict, lat, lon, item})
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error reading mandal %s: %v", l.Label, err)
+    }
+
+    columns := append([]string{"state", "district", "subdistrict", "name", "search_key", "latitude", "longitude"}, l.Columns...)
+    return config.WithTransaction(ctx, func(tx *sql.Tx) error {
+        if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s`, pq.QuoteIdentifier(l.Table))); err != nil {
+            return fmt.Errorf("error clearing %s: %v", l.Label, err)
+        }
+
+        stmt, err := tx.PrepareContext(ctx, pq.CopyIn(l.Table, columns...))
+        if err != nil {
+            return fmt.Errorf("error preparing %s copy: %v", l.Label, err)
+        }
+        for _, e := range entries {
+            values := append([]interface{}{e.state, e.district, e.subdistrict, e.item.Name,
+                utils.NormalizePlaceName(e.item.Name), e.lat, e.lon}, e.item.Values...)
+            if _, err := stmt.ExecContext(ctx, values...); err != nil {
+                stmt.Close()
+                return fmt.Errorf("error copying %s: %v", l.Label, err)
+            }
+        }
+        if _, err := stmt.ExecContext(ctx); err != nil {
+            stmt.Close()
+            return fmt.Errorf("error copying %s: %v", l.Label, err)
+        }
+        return stmt.Close()
+    })
+}
+
+// listLimit reads a limit parameter, falling back to def and capped at max
+func listLimit(raw string, def, max int) int {
+    limit, err := strconv.Atoi(raw)
+    if err != nil || limit <= 0 {
+        return def
+    }
+    if limit > max {
+        return max
+    }
+    return limit
+}
+
+// requestPoint reads the point a nearby search is centred on: lat and lon,
+// or the village given by district, subdistrict and village. It writes the
+// error response and returns false when there is none.
+func requestPoint(w http.ResponseWriter, r *http.Request) (lat, lon float64, ok bool) {
+    q := r.URL.Query()
+    if village := q.Get("village"); village != "" {
+        err := config.DB.QueryRowContext(r.Context(), `
+            SELECT
+                COALESCE(NULLIF(trim(latitude::text), '')::float8, 0),
+                COALESCE(NULLIF(trim(longitude::text), '')::float8, 0)
+            FROM villages
+            WHERE LOWER(district) = LOWER($1) AND LOWER(subdistrict) = LOWER($2)
+            AND (LOWER(locality) = LOWER($3) OR LOWER(village_name) = LOWER($3))
+            LIMIT 1`, q.Get("district"), q.Get("subdistrict"), village).Scan(&lat, &lon)
+        if err == sql.ErrNoRows {
+            http.Error(w, "Village not found", http.StatusNotFound)
+            return 0, 0, false
+        }
+        if err != nil {
+            log.Printf("Error fetching village coordinates: %v", err)
+            http.Error(w, "Error fetching village coordinates", http.StatusInternalServerError)
+            return 0, 0, false
+        }
+        if lat == 0 || lon == 0 {
+            http.Error(w, "Village has no coordinates", http.StatusUnprocessableEntity)
+            return 0, 0, false
+        }
+        return lat, lon, true
+    }
+
+    var errLat, errLon error
+    lat, errLat = strconv.ParseFloat(q.Get("lat"), 64)
+    lon, errLon = strconv.ParseFloat(q.Get("lon"), 64)
+    if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+        http.Error(w, "Valid lat and lon, or a district, subdistrict and village, are required", http.StatusBadRequest)
+        return 0, 0, false
+    }
+    return lat, lon, true
+}
+
+// requestRadius reads the radius parameter in km, falling back to def and
+// capped at max. It writes the error response and returns false when the
+// radius is invalid.
+func requestRadius(w http.ResponseWriter, r *http.Request, def, max float64) (float64, bool) {
+    radius := def
+    if raw := r.URL.Query().Get("radius"); raw != "" {
+        var err error
+        if radius, err = strconv.ParseFloat(raw, 64); err != nil || radius <= 0 {
+            http.Error(w, "Radius must be a positive number of km", http.StatusBadRequest)
+            return 0, false
+        }
+    }
+    return math.Min(radius, max), true
+}
+
+// nearbyQuery selects columns and distance_km from the rows of table, named
+// alias, within a radius of a point, narrowed by condition and sorted by
+// order. It takes nearbyArgs as $1-$6; condition's own parameters start at
+// $7.
+func nearbyQuery(table, alias, columns, condition, order string) string {
+    return fmt.Sprintf(`
+        SELECT * FROM (
+            SELECT %[3]s,
+                6371 * acos(LEAST(1.0,
+                    cos(radians($1)) * cos(radians(%[2]s.latitude)) * cos(radians(%[2]s.longitude) - radians($2)) +
+                    sin(radians($1)) * sin(radians(%[2]s.latitude))
+                )) AS distance_km
+            FROM %[1]s %[2]s
+            WHERE %[2]s.latitude BETWEEN $1 - $3 AND $1 + $3
+            AND %[2]s.longitude BETWEEN $2 - $4 AND $2 + $4
+            AND %[4]s
+        ) d
+        WHERE distance_km <= $5
+        ORDER BY %[5]s
+        LIMIT $6`, pq.QuoteIdentifier(table), alias, columns, condition, order)
+}
+
+// nearbyArgs are the parameters of nearbyQuery: the point, the bounding box
+// half-widths in degrees, the radius in km and the limit
+func nearbyArgs(lat, lon, radius float64, limit int) []interface{} {
+    latDelta := radius / 111.0
+    lonDelta := radius / (111.0 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+    return []interface{}{lat, lon, latDelta, lonDelta, radius, limit}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "village_site/config"
+    "village_site/utils"
+
+    "github.com/lib/pq"
+)
+
+// maxMatrixSide bounds the number of origins and of destinations
+const maxMatrixSide = 50
+
+type MandalRef struct {
+    District    string  `json:"district"`
+    Subdistrict string  `json:"subdistrict"`
+    Found       bool    `json:"found"`
+    Latitude    float64 `json:"latitude,omitempty"`
+    Longitude   float64 `json:"longitude,omitempty"`
+}
+
+type MandalMatrixRequest struct {
+    Origins      []MandalRef `json:"origins"`
+    Destinations []MandalRef `json:"destinations"`
+    Format       string      `json:"format"`
+}
+
+// MatrixCell is the distance from one origin to one destination; it is null
+// in the response when either mandal is unknown or lacks coordinates
+type MatrixCell struct {
+    Distance     float64                  `json:"distance"`
+    RoadDistance float64                  `json:"road_distance"`
+    TravelTimes  map[string]FormattedTime `json:"travel_times"`
+}
+
+// resolveMandals looks up the coordinates of every mandal in one query
+func resolveMandals(ctx context.Context, refs []MandalRef) error {
+    districts := make([]string, len(refs))
+    subdistricts := make([]string, len(refs))
+    for i := range refs {
+        ref := &refs[i]
+        ref.Found, ref.Latitude, ref.Longitude = false, 0, 0
+        districts[i], subdistricts[i] = ref.District, ref.Subdistrict
+    }
+
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT q.i, m.lat, m.lon
+        FROM unnest($1::text[], $2::text[]) WITH ORDINALITY AS q(district, subdistrict, i)
+        JOIN LATERAL (
+            SELECT
+                NULLIF(trim(latitude::text), '')::float8 AS lat,
+                NULLIF(trim(longitude::text), '')::float8 AS lon
+            FROM mandals
+            WHERE LOWER(district) = LOWER(trim(q.district))
+            AND LOWER(subdistrict) = LOWER(trim(q.subdistrict))
+            LIMIT 1
+        ) m ON true
+        WHERE m.lat IS NOT NULL AND m.lon IS NOT NULL AND m.lat <> 0 AND m.lon <> 0`,
+        pq.Array(districts), pq.Array(subdistricts))
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var i int
+        var lat, lon float64
+        if err := rows.Scan(&i, &lat, &lon); err != nil {
+            return err
+        }
+        ref := &refs[i-1]
+        ref.Found, ref.Latitude, ref.Longitude = true, lat, lon
+    }
+    return rows.Err()
+}
+
+// GetMandalDistanceMatrix returns the distances and travel times from every
+// origin to every destination, as JSON or, with format csv, one CSV row per
+// pair
+func GetMandalDistanceMatrix(w http.ResponseWriter, r *http.Request) {
+    var req MandalMatrixRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request format", http.StatusBadRequest)
+        return
+    }
+    if format := r.URL.Query().Get("format"); format != "" {
+        req.Format = format
+    }
+    if req.Format == "" {
+        req.Format = "json"
+    }
+    if req.Format != "json" && req.Format != "csv" {
+        http.Error(w, "Format must be json or csv", http.StatusBadRequest)
+        return
+    }
+    if len(req.Origins) == 0 || len(req.Destinations) == 0 {
+        http.Error(w, "Origins and destinations are required", http.StatusBadRequest)
+        return
+    }
+    if len(req.Origins) > maxMatrixSide || len(req.Destinations) > maxMatrixSide {
+        http.Error(w, fmt.Sprintf("At most %d origins and %d destinations are allowed", maxMatrixSide, maxMatrixSide), http.StatusBadRequest)
+        return
+    }
+    for _, ref := range append(append([]MandalRef{}, req.Origins...), req.Destinations...) {
+        if ref.District == "" || ref.Subdistrict == "" {
+            http.Error(w, "Every origin and destination needs a district and subdistrict", http.StatusBadRequest)
+            return
+        }
+    }
+
+    // Origins and destinations are resolved together
+    refs := append(append([]MandalRef{}, req.Origins...), req.Destinations...)
+    if err := resolveMandals(r.Context(), refs); err != nil {
+        log.Printf("Error resolving mandals: %v", err)
+        http.Error(w, "Error resolving mandals", http.StatusInternalServerError)
+        return
+    }
+    origins, destinations := refs[:len(req.Origins)], refs[len(req.Origins):]
+
+    cells := make([][]*MatrixCell, len(origins))
+    for i, from := range origins {
+        cells[i] = make([]*MatrixCell, len(destinations))
+        if !from.Found {
+            continue
+        }
+        for j, to := range destinations {
+            if !to.Found {
+                continue
+            }
+            distance := utils.CalculateDistance(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+            cells[i][j] = &MatrixCell{
+                Distance:     math.Round(distance*100) / 100,
+                RoadDistance: math.Round(roadDistance(distance)*100) / 100,
+                TravelTimes:  calculateTravelTimes(distance, ""),
+            }
+        }
+    }
+
+    if req.Format == "csv" {
+        writeMatrixCSV(w, origins, destinations, cells)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "origins":      origins,
+        "destinations": destinations,
+        "rows":         cells,
+    })
+}
+
+// writeMatrixCSV writes one row per origin and destination pair, with the
+// travel time per mode in minutes. Unknown mandals leave the figures blank.
+func writeMatrixCSV(w http.ResponseWriter, origins, destinations []MandalRef, cells [][]*MatrixCell) {
+    var modes []string
+    for mode := range config.TravelSpeeds("") {
+        modes = append(modes, mode)
+    }
+    sort.Strings(modes)
+
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    w.Header().Set("Content-Disposition", `attachment; filename="mandal-distances.csv"`)
+    out := csv.NewWriter(w)
+
+    header := []string{"origin_district", "origin_subdistrict", "destination_district", "destination_subdistrict", "distance_km", "road_distance_km"}
+    for _, mode := range modes {
+        header = append(header, mode+"_minutes")
+    }
+    out.Write(header)
+
+    for i, from := range origins {
+        for j, to := range destinations {
+            record := []string{from.District, from.Subdistrict, to.District, to.Subdistrict}
+            cell := cells[i][j]
+            if cell == nil {
+                record = append(record, make([]string, 2+len(modes))...)
+            } else {
+                record = append(record,
+                    strconv.FormatFloat(cell.Distance, 'f', 2, 64),
+                    strconv.FormatFloat(cell.RoadDistance, 'f', 2, 64))
+                for _, mode := range modes {
+                    t := cell.TravelTimes[mode]
+                    record = append(record, strconv.Itoa(t.Hours*60+t.Minutes))
+                }
+            }
+            out.Write(record)
+        }
+    }
+    out.Flush()
+    if err := out.Error(); err != nil {
+        log.Printf("Error writing distance matrix: %v", err)
+    }
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+    "village_site/config"
+    "village_site/models"
+)
+
+const (
+    // corridorBins is the number of stretches the route is cut into when
+    // looking for the road that dominates each stretch
+    corridorBins = 10
+    maxMainRoads = 5
+    maxLandmarks = 12
+)
+
+// corridor is the straight line between two mandals on a local flat
+// projection, with the SQL to select rows near it
+type corridor struct {
+    lat1, lon1 float64
+    kx, ky     float64 // km per degree of longitude and latitude
+    dx, dy     float64 // segment vector in km
+    bufferKm   float64
+}
+
+func newCorridor(lat1, lon1, lat2, lon2 float64) corridor {
+    c := corridor{
+        lat1:     lat1,
+        lon1:     lon1,
+        kx:       111.32 * math.Cos((lat1+lat2)/2*math.Pi/180),
+        ky:       110.57,
+        bufferKm: config.GetEnvFloat("ROUTE_CORRIDOR_KM", 10),
+    }
+    c.dx = (lon2 - lon1) * c.kx
+    c.dy = (lat2 - lat1) * c.ky
+    return c
+}
+
+// corridorParams is a CTE named p carrying the corridor's parameters, which
+// are c.args()
+const corridorParams = `p AS (
+            SELECT $1::float8 AS lat1, $2::float8 AS lon1, $3::float8 AS kx, $4::float8 AS ky,
+                $5::float8 AS dx, $6::float8 AS dy, $7::float8 AS buffer
+        )`
+
+// positionSQL returns the expression for a row's position along the
+// corridor (0 at the start, 1 at the end) and for its distance in km from the
+// line, given lat and lon expressions. They read the corridorParams CTE p.
+func corridorPositionSQL(lat, lon string) (position, offset string) {
+    x := fmt.Sprintf("((%s - p.lon1) * p.kx)", lon)
+    y := fmt.Sprintf("((%s - p.lat1) * p.ky)", lat)
+    position = fmt.Sprintf("GREATEST(0, LEAST(1, (%s * p.dx + %s * p.dy) / NULLIF(p.dx * p.dx + p.dy * p.dy, 0)))", x, y)
+    offset = fmt.Sprintf("sqrt(power(%[1]s - %[3]s * p.dx, 2) + power(%[2]s - %[3]s * p.dy, 2))", x, y, position)
+    return position, offset
+}
+
+func (c corridor) args() []interface{} {
+    return []interface{}{c.lat1, c.lon1, c.kx, c.ky, c.dx, c.dy, c.bufferKm}
+}
+
+// corridorArea is a subdistrict along the corridor, with the highways its
+// villages lie on
+type corridorArea struct {
+    District    string
+    Subdistrict string
+    Position    float64
+    Villages    int
+    Highways    map[string]int
+}
+
+// corridorAreas returns the subdistricts whose villages lie within the
+// corridor, ordered along it. Villages are read from the village points of
+// tile_points, whose numeric coordinates are indexed.
+func corridorAreas(ctx context.Context, c corridor) ([]corridorArea, error) {
+    position, offset := corridorPositionSQL("v.lat", "v.lon")
+    query := fmt.Sprintf(`
+        WITH %[3]s
+        SELECT v.district, v.subdistrict, v.highways, AVG(%[1]s), COUNT(*)
+        FROM tile_points v, p
+        WHERE v.layer = 'villages'
+        AND v.lat BETWEEN LEAST(p.lat1, p.lat1 + p.dy / p.ky) - p.buffer / p.ky
+            AND GREATEST(p.lat1, p.lat1 + p.dy / p.ky) + p.buffer / p.ky
+        AND v.lon BETWEEN LEAST(p.lon1, p.lon1 + p.dx / p.kx) - p.buffer / p.kx
+            AND GREATEST(p.lon1, p.lon1 + p.dx / p.kx) + p.buffer / p.kx
+        AND %[2]s <= p.buffer
+        GROUP BY v.district, v.subdistrict, v.highways`, position, offset, corridorParams)
+
+    rows, err := config.DB.QueryContext(ctx, query, c.args()...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    index := make(map[string]*corridorArea)
+    for rows.Next() {
+        var district, subdistrict, highwaysJSON string
+        var position float64
+        var villages int
+        if err := rows.Scan(&district, &subdistrict, &highwaysJSON, &position, &villages); err != nil {
+            return nil, err
+        }
+
+        key := strings.ToLower(district + "\x00" + subdistrict)
+        area, ok := index[key]
+        if !ok {
+            area = &corridorArea{District: district, Subdistrict: subdistrict, Highways: make(map[string]int)}
+            index[key] = area
+        }
+        area.Position = (area.Position*float64(area.Villages) + position*float64(villages)) / float64(area.Villages+villages)
+        area.Villages += villages
+
+        var highways []Highway
+        if err := decodeJSONColumn(highwaysJSON, &highways); err != nil {
+            continue
+        }
+        for _, h := range highways {
+            if name := strings.TrimSpace(h.Highway); name != "" {
+                area.Highways[name] += villages
+            }
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    areas := make([]corridorArea, 0, len(index))
+    for _, area := range index {
+        areas = append(areas, *area)
+    }
+    sort.Slice(areas, func(i, j int) bool { return areas[i].Position < areas[j].Position })
+    return areas, nil
+}
+
+// dominantHighway returns the highway with the most villages in counts
+func dominantHighway(counts map[string]int) string {
+    best, bestCount := "", 0
+    for name, count := range counts {
+        if count > bestCount || (count == bestCount && name < best) {
+            best, bestCount = name, count
+        }
+    }
+    return best
+}
+
+// mainRoadsAndInterchanges ranks the highways along the corridor by the
+// number of villages on them, and reports where the dominant highway of one
+// stretch gives way to the next
+func mainRoadsAndInterchanges(areas []corridorArea) (mainRoads, interchanges []string) {
+    total := make(map[string]int)
+    bins := make([]map[string]int, corridorBins)
+    for i := range bins {
+        bins[i] = make(map[string]int)
+    }
+    for _, area := range areas {
+        bin := int(area.Position * corridorBins)
+        if bin >= corridorBins {
+            bin = corridorBins - 1
+        }
+        for name, count := range area.Highways {
+            total[name] += count
+            bins[bin][name] += count
+        }
+    }
+
+    for name := range total {
+        mainRoads = append(mainRoads, name)
+    }
+    sort.Slice(mainRoads, func(i, j int) bool {
+        if total[mainRoads[i]] != total[mainRoads[j]] {
+            return total[mainRoads[i]] > total[mainRoads[j]]
+        }
+        return mainRoads[i] < mainRoads[j]
+    })
+    if len(mainRoads) > maxMainRoads {
+        mainRoads = mainRoads[:maxMainRoads]
+    }
+
+    previous := ""
+    for bin, counts := range bins {
+        current := dominantHighway(counts)
+        if current == "" {
+            continue
+        }
+        if previous != "" && current != previous {
+            // The first area of the stretch that lies on both roads, or
+            // failing that on the new one
+            start, end := float64(bin)/corridorBins, float64(bin+1)/corridorBins
+            var junction *corridorArea
+            for i := range areas {
+                area := &areas[i]
+                if area.Position >= end && bin < corridorBins-1 {
+                    break
+                }
+                if area.Position < start || area.Highways[current] == 0 {
+                    continue
+                }
+                if junction == nil || (area.Highways[previous] > 0 && junction.Highways[previous] == 0) {
+                    junction = area
+                }
+                if junction.Highways[previous] > 0 {
+                    break
+                }
+            }
+            if junction != nil {
+                interchanges = append(interchanges, fmt.Sprintf("%s, %s (%s / %s)",
+                    junction.Subdistrict, junction.District, previous, current))
+            }
+        }
+        previous = current
+    }
+    return mainRoads, interchanges
+}
+
+// corridorLandmarks lists, in order along the corridor, district
+// headquarters and tourist places of the mandals within it
+func corridorLandmarks(ctx context.Context, c corridor) ([]string, error) {
+    position, offset := corridorPositionSQL("lat", "lon")
+    query := fmt.Sprintf(`
+        WITH m AS (
+            SELECT district, subdistrict,
+                COALESCE(headquarters, '') AS headquarters,
+                COALESCE(tourist_places::text, '') AS tourist_places,
+                NULLIF(trim(latitude::text), '')::float8 AS lat,
+                NULLIF(trim(longitude::text), '')::float8 AS lon
+            FROM mandals
+            WHERE NULLIF(trim(latitude::text), '') IS NOT NULL
+            AND NULLIF(trim(longitude::text), '') IS NOT NULL
+        ),
+        %[3]s
+        SELECT district, subdistrict, headquarters, tourist_places, %[1]s AS position
+        FROM m, p
+        WHERE %[2]s <= p.buffer
+        AND lat <> 0 AND lon <> 0
+        ORDER BY position`, position, offset, corridorParams)
+
+    rows, err := config.DB.QueryContext(ctx, query, c.args()...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var landmarks []string
+    seen := make(map[string]bool)
+    add := func(landmark string) {
+        if key := strings.ToLower(landmark); !seen[key] {
+            seen[key] = true
+            landmarks = append(landmarks, landmark)
+        }
+    }
+    for rows.Next() {
+        var district, subdistrict, headquarters, touristPlacesJSON string
+        var position float64
+        if err := rows.Scan(&district, &subdistrict, &headquarters, &touristPlacesJSON, &position); err != nil {
+            return nil, err
+        }
+
+        // A district's headquarters is the subdistrict named after it
+        if strings.EqualFold(strings.TrimSpace(subdistrict), strings.TrimSpace(district)) {
+            name := headquarters
+            if name == "" {
+                name = subdistrict
+            }
+            add(fmt.Sprintf("%s (%s district headquarters)", name, district))
+        }
+
+        var places []models.TouristPlace
+        if err := decodeJSONColumn(touristPlacesJSON, &places); err == nil {
+            for _, place := range places {
+                if name := strings.TrimSpace(place.Name); name != "" {
+                    add(fmt.Sprintf("%s, %s", name, subdistrict))
+                }
+            }
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    if len(landmarks) > maxLandmarks {
+        landmarks = landmarks[:maxLandmarks]
+    }
+    return landmarks, nil
+}
+
+// fillRouteDetails infers the main roads, landmarks and interchanges between
+// two mandals from the villages and mandals along the straight line joining
+// them
+func fillRouteDetails(ctx context.Context, info *TravelInfo, from, to *MandalDetails) error {
+    info.RouteDetails.MainRoads = []string{}
+    info.RouteDetails.Landmarks = []string{}
+    info.RouteDetails.Interchanges = []string{}
+
+    a, b := from.BasicInfo, to.BasicInfo
+    if a.Latitude == 0 || a.Longitude == 0 || b.Latitude == 0 || b.Longitude == 0 {
+        return nil
+    }
+    c := newCorridor(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+
+    areas, err := corridorAreas(ctx, c)
+    if err != nil {
+        return fmt.Errorf("error reading villages along the route: %v", err)
+    }
+    mainRoads, interchanges := mainRoadsAndInterchanges(areas)
+    if mainRoads != nil {
+        info.RouteDetails.MainRoads = mainRoads
+    }
+    if interchanges != nil {
+        info.RouteDetails.Interchanges = interchanges
+    }
+
+    landmarks, err := corridorLandmarks(ctx, c)
+    if err != nil {
+        return fmt.Errorf("error reading mandals along the route: %v", err)
+    }
+    if landmarks != nil {
+        info.RouteDetails.Landmarks = landmarks
+    }
+    return nil
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+    "village_site/config"
+    "village_site/utils"
+)
+
+const (
+    mandalNamesCacheKey = "mandal:names"
+    maxSuggestions      = 10
+    minSuggestionScore  = 0.6
+)
+
+// mandalAliasColumns are the alternate name columns of mandals, with the
+// alias kind reported when one of them matches
+var mandalAliasColumns = []struct {
+    Column string
+    Kind   string
+}{
+    {"alternate_mandal_name", "mandal"},
+    {"alternate_city_name", "city"},
+    {"alternate_tehsil_name", "tehsil"},
+    {"alternate_block_name", "block"},
+    {"alternate_taluk_name", "taluk"},
+    {"alternate_taluka_name", "taluka"},
+}
+
+// aliasSeparators split columns that hold several alternate names
+var aliasSeparators = regexp.MustCompile(`\s*[,;/|]\s*`)
+
+// mandalName is one searchable name of a subdistrict: its own name or an
+// alias
+type mandalName struct {
+    District    string
+    Subdistrict string
+    Name        string
+    Kind        string // "" for the subdistrict's own name
+    normalized  string
+    phonetic    string
+}
+
+func newMandalName(district, subdistrict, name, kind string) mandalName {
+    normalized := utils.NormalizePlaceName(name)
+    return mandalName{
+        District:    district,
+        Subdistrict: subdistrict,
+        Name:        name,
+        Kind:        kind,
+        normalized:  normalized,
+        phonetic:    utils.PhoneticKey(normalized),
+    }
+}
+
+// loadMandalNames returns every subdistrict name and alias, cached for an
+// hour
+func loadMandalNames(ctx context.Context) ([]mandalName, error) {
+    if cached, found := config.VillageCache.Get(mandalNamesCacheKey); found {
+        return cached.([]mandalName), nil
+    }
+
+    columns := make([]string, len(mandalAliasColumns))
+    for i, alias := range mandalAliasColumns {
+        columns[i] = fmt.Sprintf("COALESCE(%s, '')", alias.Column)
+    }
+    rows, err := config.DB.QueryContext(ctx, fmt.Sprintf(`
+        SELECT DISTINCT district, subdistrict, %s
+        FROM mandals
+        WHERE NULLIF(trim(district), '') IS NOT NULL
+        AND NULLIF(trim(subdistrict), '') IS NOT NULL`, strings.Join(columns, ", ")))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var names []mandalName
+    for rows.Next() {
+        var district, subdistrict string
+        aliases := make([]string, len(mandalAliasColumns))
+        dest := []interface{}{&district, &subdistrict}
+        for i := range aliases {
+            dest = append(dest, &aliases[i])
+        }
+        if err := rows.Scan(dest...); err != nil {
+            return nil, err
+        }
+
+        names = append(names, newMandalName(district, subdistrict, subdistrict, ""))
+        for i, value := range aliases {
+            for _, alias := range aliasSeparators.Split(strings.TrimSpace(value), -1) {
+                if alias != "" && !strings.EqualFold(alias, subdistrict) {
+                    names = append(names, newMandalName(district, subdistrict, alias, mandalAliasColumns[i].Kind))
+                }
+            }
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    config.VillageCache.Set(mandalNamesCacheKey, names, time.Hour)
+    return names, nil
+}
+
+// suggestionScore rates how well a name matches what the user typed, from 0
+// to 1. Exact and prefix matches rank first, then matches inside the name,
+// then names that sound alike, then names within a few typos; a typo is also
+// tolerated in a partly typed prefix.
+func suggestionScore(query, queryKey string, name mandalName) float64 {
+    n := name.normalized
+    switch {
+    case n == query:
+        return 1
+    case strings.HasPrefix(n, query):
+        return 0.9 + 0.05*float64(len(query))/float64(len(n))
+    case strings.Contains(" "+n, " "+query):
+        return 0.85
+    case strings.Contains(n, query):
+        return 0.8
+    case queryKey != "" && name.phonetic == queryKey:
+        return 0.8
+    }
+
+    score := utils.Similarity(query, n)
+    if runes := []rune(n); len(runes) > len([]rune(query)) {
+        if prefix := utils.Similarity(query, string(runes[:len([]rune(query))])) * 0.95; prefix > score {
+            score = prefix
+        }
+    }
+    if len([]rune(query)) >= 3 && len(queryKey) >= 2 && strings.HasPrefix(name.phonetic, queryKey) && score < 0.75 {
+        score = 0.75
+    }
+    return score * 0.9
+}
+
+type scoredSuggestion struct {
+    name  mandalName
+    score float64
+}
+
+// rankSuggestions scores names against the query and keeps the best match
+// per canonical name given by key, best first
+func rankSuggestions(query string, names []mandalName, key func(mandalName) string) []scoredSuggestion {
+    query = utils.NormalizePlaceName(query)
+    queryKey := utils.PhoneticKey(query)
+
+    best := make(map[string]scoredSuggestion)
+    for _, name := range names {
+        score := 1.0
+        if query != "" {
+            score = suggestionScore(query, queryKey, name)
+        }
+        if score < minSuggestionScore {
+            continue
+        }
+        k := key(name)
+        // Prefer the canonical name over an alias that scores the same
+        if current, ok := best[k]; !ok || score > current.score || (score == current.score && name.Kind == "" && current.name.Kind != "") {
+            best[k] = scoredSuggestion{name, score}
+        }
+    }
+
+    ranked := make([]scoredSuggestion, 0, len(best))
+    for _, s := range best {
+        ranked = append(ranked, s)
+    }
+    sort.Slice(ranked, func(i, j int) bool {
+        if ranked[i].score != ranked[j].score {
+            return ranked[i].score > ranked[j].score
+        }
+        return key(ranked[i].name) < key(ranked[j].name)
+    })
+    if len(ranked) > maxSuggestions {
+        ranked = ranked[:maxSuggestions]
+    }
+    return ranked
+}
+
+// matchDistrict returns the district names equal to district or, failing
+// that, the closest spelling
+func matchDistrict(district string, names []mandalName) string {
+    districts := make([]mandalName, 0)
+    seen := make(map[string]bool)
+    for _, name := range names {
+        if !seen[name.District] {
+            seen[name.District] = true
+            if strings.EqualFold(name.District, district) {
+                return name.District
+            }
+            districts = append(districts, newMandalName(name.District, "", name.District, ""))
+        }
+    }
+    ranked := rankSuggestions(district, districts, func(n mandalName) string { return n.District })
+    if len(ranked) == 0 || ranked[0].score < 0.8 {
+        return ""
+    }
+    return ranked[0].name.District
+}
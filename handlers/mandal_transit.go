@@ -0,0 +1,418 @@
+package handlers
+
+import (
+    "context"
+    "log"
+    "math"
+    "sort"
+    "strings"
+    "time"
+    "village_site/config"
+    "village_site/models"
+    "village_site/utils"
+
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+    // stationsPerEnd is how many of the nearest stations are tried at
+    // each end of a journey
+    stationsPerEnd    = 3
+    maxTransitOptions = 5
+    // accessMode is the road mode assumed to and from stations and stops
+    accessMode        = "auto"
+    busRoutesCacheKey = "transit:bus_routes"
+)
+
+// TransitStop is a station or bus stop used at one end of a journey
+type TransitStop struct {
+    Code     string  `json:"code,omitempty"`
+    Name     string  `json:"name"`
+    Distance float64 `json:"distance"` // km from the mandal
+}
+
+type RailOption struct {
+    TrainNumber  int           `json:"train_number"`
+    TrainName    string        `json:"train_name"`
+    Type         string        `json:"type"`
+    From         TransitStop   `json:"from_station"`
+    To           TransitStop   `json:"to_station"`
+    Departure    string        `json:"departure"`
+    Arrival      string        `json:"arrival"`
+    RailDistance float64       `json:"rail_distance"`
+    AccessTime   FormattedTime `json:"access_time"`
+    RideTime     FormattedTime `json:"ride_time"`
+    EgressTime   FormattedTime `json:"egress_time"`
+    TotalTime    FormattedTime `json:"total_time"`
+    totalHours   float64
+}
+
+type BusOption struct {
+    RouteName  string        `json:"route_name"`
+    From       TransitStop   `json:"from_stop"`
+    To         TransitStop   `json:"to_stop"`
+    Stops      int           `json:"stops"`
+    RideKm     float64       `json:"ride_distance"`
+    AccessTime FormattedTime `json:"access_time"`
+    RideTime   FormattedTime `json:"ride_time"`
+    EgressTime FormattedTime `json:"egress_time"`
+    TotalTime  FormattedTime `json:"total_time"`
+    totalHours float64
+}
+
+// RailTravel lists direct trains between the stations nearest to two
+// mandals; Available is false, with a Message, when there are none
+type RailTravel struct {
+    Available    bool          `json:"available"`
+    Message      string        `json:"message,omitempty"`
+    FromStations []TransitStop `json:"from_stations"`
+    ToStations   []TransitStop `json:"to_stations"`
+    Options      []RailOption  `json:"options"`
+}
+
+// BusTravel lists direct city bus routes when both mandals are served by
+// the same city's buses
+type BusTravel struct {
+    Available bool        `json:"available"`
+    Message   string      `json:"message,omitempty"`
+    City      string      `json:"city,omitempty"`
+    Options   []BusOption `json:"options"`
+}
+
+// accessHours is the time to cover a straight-line distance by road to or
+// from a station or stop
+func accessHours(distance float64) float64 {
+    speed := config.TravelSpeeds("")[accessMode]
+    if speed <= 0 {
+        return 0
+    }
+    return roadDistance(distance) / speed
+}
+
+// parseScheduleTime reads a timetable time such as "05:20 AM" or "17:45"
+// as minutes after midnight
+func parseScheduleTime(value string) (int, bool) {
+    value = strings.ToUpper(strings.TrimSpace(value))
+    for _, layout := range []string{"03:04 PM", "3:04 PM", "03:04PM", "15:04", "15:04:05"} {
+        if t, err := time.Parse(layout, value); err == nil {
+            return t.Hour()*60 + t.Minute(), true
+        }
+    }
+    return 0, false
+}
+
+// nearestStations returns the stations closest to a point within
+// STATION_SEARCH_KM (default 50)
+func nearestStations(ctx context.Context, lat, lon float64) ([]models.Station, []float64, error) {
+    radius := config.GetEnvFloat("STATION_SEARCH_KM", 50)
+    latDelta := radius / 111.0
+    lonDelta := radius / (111.0 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+
+    cursor, err := config.MongoDB.Collection("stations").Find(ctx, bson.M{
+        "location.latitude":  bson.M{"$gte": lat - latDelta, "$lte": lat + latDelta},
+        "location.longitude": bson.M{"$gte": lon - lonDelta, "$lte": lon + lonDelta},
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+    defer cursor.Close(ctx)
+
+    var candidates []models.Station
+    if err := cursor.All(ctx, &candidates); err != nil {
+        return nil, nil, err
+    }
+
+    distances := make(map[string]float64, len(candidates))
+    var stations []models.Station
+    for _, s := range candidates {
+        d := utils.CalculateDistance(lat, lon, s.Location.Latitude, s.Location.Longitude)
+        if d <= radius {
+            distances[s.Code] = d
+            stations = append(stations, s)
+        }
+    }
+    sort.Slice(stations, func(i, j int) bool { return distances[stations[i].Code] < distances[stations[j].Code] })
+    if len(stations) > stationsPerEnd {
+        stations = stations[:stationsPerEnd]
+    }
+
+    dist := make([]float64, len(stations))
+    for i, s := range stations {
+        dist[i] = math.Round(distances[s.Code]*100) / 100
+    }
+    return stations, dist, nil
+}
+
+// findRailOptions looks for direct trains from a station near one mandal to
+// a station near the other, ranked by total journey time including the road
+// legs to and from the stations
+func findRailOptions(ctx context.Context, from, to *MandalDetails) RailTravel {
+    travel := RailTravel{FromStations: []TransitStop{}, ToStations: []TransitStop{}, Options: []RailOption{}}
+    a, b := from.BasicInfo, to.BasicInfo
+    if a.Latitude == 0 || a.Longitude == 0 || b.Latitude == 0 || b.Longitude == 0 {
+        travel.Message = "Coordinates are missing for one of the mandals"
+        return travel
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    fromStations, fromDistances, err := nearestStations(ctx, a.Latitude, a.Longitude)
+    if err != nil {
+        log.Printf("Error finding stations near %s: %v", a.Subdistrict, err)
+        travel.Message = "Rail information is unavailable"
+        return travel
+    }
+    toStations, toDistances, err := nearestStations(ctx, b.Latitude, b.Longitude)
+    if err != nil {
+        log.Printf("Error finding stations near %s: %v", b.Subdistrict, err)
+        travel.Message = "Rail information is unavailable"
+        return travel
+    }
+
+    fromStops := make(map[string]TransitStop)
+    toStops := make(map[string]TransitStop)
+    var fromCodes, toCodes []string
+    for i, s := range fromStations {
+        stop := TransitStop{Code: s.Code, Name: s.Name, Distance: fromDistances[i]}
+        travel.FromStations = append(travel.FromStations, stop)
+        fromStops[s.Code] = stop
+        fromCodes = append(fromCodes, s.Code)
+    }
+    for i, s := range toStations {
+        stop := TransitStop{Code: s.Code, Name: s.Name, Distance: toDistances[i]}
+        travel.ToStations = append(travel.ToStations, stop)
+        toStops[s.Code] = stop
+        toCodes = append(toCodes, s.Code)
+    }
+
+    switch {
+    case len(fromCodes) == 0 && len(toCodes) == 0:
+        travel.Message = "No railway station near either mandal"
+        return travel
+    case len(fromCodes) == 0:
+        travel.Message = "No railway station near " + a.Subdistrict
+        return travel
+    case len(toCodes) == 0:
+        travel.Message = "No railway station near " + b.Subdistrict
+        return travel
+    }
+
+    cursor, err := config.MongoDB.Collection("trains").Find(ctx, bson.M{
+        "$and": []bson.M{
+            {"schedule.station": bson.M{"$in": fromCodes}},
+            {"schedule.station": bson.M{"$in": toCodes}},
+        },
+    })
+    if err != nil {
+        log.Printf("Error finding trains: %v", err)
+        travel.Message = "Rail information is unavailable"
+        return travel
+    }
+    defer cursor.Close(ctx)
+
+    var trains []models.Train
+    if err := cursor.All(ctx, &trains); err != nil {
+        log.Printf("Error reading trains: %v", err)
+        travel.Message = "Rail information is unavailable"
+        return travel
+    }
+
+    for _, train := range trains {
+        var best *RailOption
+        for i, boarding := range train.Schedule {
+            origin, ok := fromStops[boarding.Station]
+            if !ok {
+                continue
+            }
+            departure, ok := parseScheduleTime(boarding.Departure)
+            if !ok {
+                continue
+            }
+            for _, alighting := range train.Schedule[i+1:] {
+                destination, ok := toStops[alighting.Station]
+                if !ok {
+                    continue
+                }
+                arrivalText := alighting.Arrival
+                if arrivalText == "" {
+                    arrivalText = alighting.Departure
+                }
+                arrival, ok := parseScheduleTime(arrivalText)
+                if !ok {
+                    continue
+                }
+
+                minutes := (alighting.Day-boarding.Day)*24*60 + arrival - departure
+                for minutes < 0 {
+                    minutes += 24 * 60
+                }
+                access, egress := accessHours(origin.Distance), accessHours(destination.Distance)
+                ride := float64(minutes) / 60
+                option := RailOption{
+                    TrainNumber:  train.TrainNumber,
+                    TrainName:    train.Name,
+                    Type:         train.Type,
+                    From:         origin,
+                    To:           destination,
+                    Departure:    boarding.Departure,
+                    Arrival:      arrivalText,
+                    RailDistance: math.Max(alighting.Distance-boarding.Distance, 0),
+                    AccessTime:   formatTime(access),
+                    RideTime:     formatTime(ride),
+                    EgressTime:   formatTime(egress),
+                    TotalTime:    formatTime(access + ride + egress),
+                    totalHours:   access + ride + egress,
+                }
+                if best == nil || option.totalHours < best.totalHours {
+                    best = &option
+                }
+            }
+        }
+        if best != nil {
+            travel.Options = append(travel.Options, *best)
+        }
+    }
+
+    if len(travel.Options) == 0 {
+        travel.Message = "No direct train between the stations nearest to these mandals"
+        return travel
+    }
+    sort.Slice(travel.Options, func(i, j int) bool { return travel.Options[i].totalHours < travel.Options[j].totalHours })
+    if len(travel.Options) > maxTransitOptions {
+        travel.Options = travel.Options[:maxTransitOptions]
+    }
+    travel.Available = true
+    return travel
+}
+
+// cityBusRoutes returns every bus route with its stops decoded, grouped by
+// lowercased city. Routes change rarely, so they are cached.
+func cityBusRoutes(ctx context.Context) (map[string][]models.BusRoute, error) {
+    if cached, found := config.VillageCache.Get(busRoutesCacheKey); found {
+        return cached.(map[string][]models.BusRoute), nil
+    }
+
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT COALESCE(city, ''), COALESCE(route_name, ''), COALESCE(route::text, '')
+        FROM bus_routes`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    routes := make(map[string][]models.BusRoute)
+    for rows.Next() {
+        var route models.BusRoute
+        var stopsJSON string
+        if err := rows.Scan(&route.City, &route.RouteName, &stopsJSON); err != nil {
+            return nil, err
+        }
+        if err := decodeJSONColumn(stopsJSON, &route.Route); err != nil || len(route.Route) < 2 {
+            continue
+        }
+        city := strings.ToLower(strings.TrimSpace(route.City))
+        routes[city] = append(routes[city], route)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    config.VillageCache.Set(busRoutesCacheKey, routes, 6*time.Hour)
+    return routes, nil
+}
+
+// nearestStop returns the index of the stop of a route closest to a point,
+// and its distance
+func nearestStop(route models.BusRoute, lat, lon float64) (int, float64) {
+    best, bestDistance := -1, math.MaxFloat64
+    for i, stop := range route.Route {
+        if d := utils.CalculateDistance(lat, lon, stop.Lat, stop.Lng); d < bestDistance {
+            best, bestDistance = i, d
+        }
+    }
+    return best, bestDistance
+}
+
+// findBusOptions looks for city bus routes that pass within
+// BUS_STOP_SEARCH_KM (default 2) of both mandals. Routes are taken to run in
+// both directions.
+func findBusOptions(ctx context.Context, from, to *MandalDetails) BusTravel {
+    travel := BusTravel{Options: []BusOption{}}
+    a, b := from.BasicInfo, to.BasicInfo
+    if a.Latitude == 0 || a.Longitude == 0 || b.Latitude == 0 || b.Longitude == 0 {
+        travel.Message = "Coordinates are missing for one of the mandals"
+        return travel
+    }
+
+    routesByCity, err := cityBusRoutes(ctx)
+    if err != nil {
+        log.Printf("Error reading bus routes: %v", err)
+        travel.Message = "Bus information is unavailable"
+        return travel
+    }
+
+    radius := config.GetEnvFloat("BUS_STOP_SEARCH_KM", 2)
+    servedBoth := false
+    for _, routes := range routesByCity {
+        servedFrom, servedTo := false, false
+        var options []BusOption
+        for _, route := range routes {
+            i, di := nearestStop(route, a.Latitude, a.Longitude)
+            j, dj := nearestStop(route, b.Latitude, b.Longitude)
+            servedFrom = servedFrom || di <= radius
+            servedTo = servedTo || dj <= radius
+            if di > radius || dj > radius || i == j {
+                continue
+            }
+
+            first, last := i, j
+            if first > last {
+                first, last = last, first
+            }
+            ride := 0.0
+            for k := first; k < last; k++ {
+                ride += utils.CalculateDistance(route.Route[k].Lat, route.Route[k].Lng, route.Route[k+1].Lat, route.Route[k+1].Lng)
+            }
+
+            rideHours := ride / config.TravelSpeeds("")["bus"]
+            access, egress := accessHours(di), accessHours(dj)
+            options = append(options, BusOption{
+                RouteName:  route.RouteName,
+                From:       TransitStop{Name: route.Route[i].StopName, Distance: math.Round(di*100) / 100},
+                To:         TransitStop{Name: route.Route[j].StopName, Distance: math.Round(dj*100) / 100},
+                Stops:      last - first,
+                RideKm:     math.Round(ride*100) / 100,
+                AccessTime: formatTime(access),
+                RideTime:   formatTime(rideHours),
+                EgressTime: formatTime(egress),
+                TotalTime:  formatTime(access + rideHours + egress),
+                totalHours: access + rideHours + egress,
+            })
+        }
+
+        if servedFrom && servedTo {
+            servedBoth = true
+            if travel.City == "" || len(options) > len(travel.Options) {
+                travel.City = routes[0].City
+                travel.Options = options
+            }
+        }
+    }
+
+    if !servedBoth {
+        travel.Message = "These mandals are not both served by one city's buses"
+        return travel
+    }
+    if len(travel.Options) == 0 {
+        travel.Message = "No direct city bus route between these mandals"
+        return travel
+    }
+
+    sort.Slice(travel.Options, func(i, j int) bool { return travel.Options[i].totalHours < travel.Options[j].totalHours })
+    if len(travel.Options) > maxTransitOptions {
+        travel.Options = travel.Options[:maxTransitOptions]
+    }
+    travel.Available = true
+    return travel
+}
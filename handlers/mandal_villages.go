@@ -0,0 +1,237 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "village_site/config"
+
+    "github.com/lib/pq"
+)
+
+const (
+    defaultMandalVillageLimit = 50
+    maxMandalVillageLimit     = 500
+)
+
+// mandalVillageSorts maps the sort keys accepted for a mandal's villages to
+// expressions over the located villages (alias v) and, for the census
+// figures, the sortCensus join of the query below
+var mandalVillageSorts = map[string]string{
+    "name":       "v.name",
+    "population": "COALESCE(sc.population, 0)::bigint",
+    "area":       "COALESCE(sc.area, 0)",
+    "distance":   "v.distance",
+}
+
+// mandalVillageCensus matches a located village (alias v, with the columns
+// of its census link) to its village_census row c. Unlinked villages are
+// matched by name.
+const mandalVillageCensus = `LOWER(trim(c.district)) = CASE WHEN v.method IS NULL THEN LOWER(trim(v.district)) ELSE v.census_district END
+                AND LOWER(trim(c.subdistrict)) = CASE WHEN v.method IS NULL THEN LOWER(trim(v.subdistrict)) ELSE v.census_subdistrict END
+                AND LOWER(trim(c.village)) = CASE WHEN v.method IS NULL THEN LOWER(trim(v.name)) ELSE v.census_village END`
+
+// VillagePage describes the slice of a mandal's villages in a response
+type VillagePage struct {
+    Page  int    `json:"page"`
+    Limit int    `json:"limit"`
+    Total int    `json:"total"`
+    Sort  string `json:"sort"`
+    Order string `json:"order"`
+}
+
+// normalize fills in defaults and clamps the page to the allowed range
+func (p *VillagePage) normalize() {
+    if _, ok := mandalVillageSorts[p.Sort]; !ok {
+        p.Sort = "name"
+    }
+    if p.Order != "asc" && p.Order != "desc" {
+        p.Order = "asc"
+        if p.Sort == "population" || p.Sort == "area" {
+            p.Order = "desc"
+        }
+    }
+    if p.Page < 1 {
+        p.Page = 1
+    }
+    if p.Limit < 1 {
+        p.Limit = defaultMandalVillageLimit
+    }
+    if p.Limit > maxMandalVillageLimit {
+        p.Limit = maxMandalVillageLimit
+    }
+}
+
+// facilityCountJoin counts the facilities of one registry type per village
+// of the page, or yields no rows if the type is not registered
+func facilityCountJoin(key, alias string) string {
+    t, ok := config.FindFacilityType(key)
+    if !ok {
+        return fmt.Sprintf(`LEFT JOIN (SELECT ''::text AS village, 0 AS n WHERE false) %s ON false`, alias)
+    }
+    return fmt.Sprintf(`
+        LEFT JOIN (
+            SELECT LOWER(trim(village)) AS village, COUNT(*) AS n
+            FROM %s
+            WHERE LOWER(district) = LOWER($1) AND LOWER(subdistrict) = LOWER($2)
+            AND LOWER(trim(village)) IN (SELECT LOWER(trim(name)) FROM paged)
+            GROUP BY 1
+        ) %s ON %s.village = LOWER(trim(v.name))`, pq.QuoteIdentifier(t.Table), alias, alias)
+}
+
+// getMandalVillages fills mandalDetails.Villages with one page of the
+// subdistrict's villages. Census figures come through the village's census
+// link; distances are measured from the mandal's coordinates. The page is
+// cut first, so amenities and bank, post office and facility counts are only
+// computed for the villages on it.
+func getMandalVillages(ctx context.Context, mandalDetails *MandalDetails, district, subdistrict string, page VillagePage) error {
+    page.normalize()
+
+    amenities := make([]string, len(censusAmenityColumns))
+    for i, column := range censusAmenityColumns {
+        amenities[i] = fmt.Sprintf(`CASE WHEN COALESCE(vc.%[1]s, 0) = 1 THEN '%[1]s' END`, column)
+    }
+
+    sortCensus := ""
+    if page.Sort == "population" || page.Sort == "area" {
+        sortCensus = `
+            LEFT JOIN LATERAL (
+                SELECT NULLIF(trim(c.total_population::text), '')::float8 AS population,
+                    NULLIF(trim(c.total_area::text), '')::float8 AS area
+                FROM village_census c
+                WHERE ` + mandalVillageCensus + `
+                LIMIT 1
+            ) sc ON true`
+    }
+
+    query := fmt.Sprintf(`
+        WITH v AS (
+            -- villages may share a name within a subdistrict; only repeated
+            -- rows of the same place (same PIN code and coordinates) are merged
+            SELECT DISTINCT ON (LOWER(trim(COALESCE(locality, village_name))), COALESCE(pin_code::text, ''),
+                NULLIF(trim(latitude::text), '')::float8, NULLIF(trim(longitude::text), '')::float8)
+                COALESCE(locality, village_name) AS name,
+                district,
+                subdistrict,
+                COALESCE(pin_code::text, '') AS pin_code,
+                NULLIF(trim(latitude::text), '')::float8 AS lat,
+                NULLIF(trim(longitude::text), '')::float8 AS lon
+            FROM villages
+            WHERE LOWER(district) = LOWER($1) AND LOWER(subdistrict) = LOWER($2)
+            AND NULLIF(trim(COALESCE(locality, village_name)), '') IS NOT NULL
+            ORDER BY LOWER(trim(COALESCE(locality, village_name))), COALESCE(pin_code::text, ''),
+                NULLIF(trim(latitude::text), '')::float8, NULLIF(trim(longitude::text), '')::float8
+        ),
+        located AS (
+            SELECT v.*,
+                CASE WHEN $3 AND v.lat <> 0 AND v.lon <> 0 THEN
+                    ROUND((6371 * acos(LEAST(1.0,
+                        cos(radians($4)) * cos(radians(v.lat)) * cos(radians(v.lon) - radians($5)) +
+                        sin(radians($4)) * sin(radians(v.lat))
+                    )))::numeric, 2)::float8
+                END AS distance,
+                l.method, l.census_district, l.census_subdistrict, l.census_village
+            FROM v
+            LEFT JOIN village_census_links l
+                ON l.district = LOWER(trim(v.district))
+                AND l.subdistrict = LOWER(trim(v.subdistrict))
+                AND l.locality = LOWER(trim(v.name))
+        ),
+        paged AS (
+            SELECT v.*, %[5]s AS sort_value, COUNT(*) OVER () AS total
+            FROM located v
+            %[6]s
+            ORDER BY sort_value %[7]s NULLS LAST, v.name, v.pin_code, v.lat, v.lon
+            LIMIT $6 OFFSET $7
+        ),
+        listed AS (
+            SELECT
+                v.name,
+                v.pin_code,
+                v.sort_value,
+                v.total,
+                COALESCE(NULLIF(trim(vc.total_population::text), '')::float8, 0)::bigint AS population,
+                COALESCE(NULLIF(trim(vc.total_area::text), '')::float8, 0) AS area,
+                COALESCE(vc.gram_panchayat, '') AS panchayat,
+                v.distance,
+                array_remove(ARRAY[%[1]s], NULL) AS amenities,
+                COALESCE(schools.n, 0) AS schools,
+                COALESCE(hospitals.n, 0) AS hospitals,
+                (
+                    SELECT COUNT(*) FROM ifsc_details b
+                    WHERE UPPER(b.district) = UPPER(v.district) AND UPPER(b.branch_city) = UPPER(v.name)
+                ) AS banks,
+                (
+                    SELECT COUNT(*) FROM pin_details p
+                    WHERE v.pin_code <> '' AND p.pincode::text = v.pin_code
+                ) AS post_offices,
+                CASE
+                    WHEN vc.village IS NULL THEN ''
+                    WHEN COALESCE(vc.treated_tap_water, 0) = 1 THEN 'Treated tap water'
+                    WHEN COALESCE(vc.untreated_water, 0) = 1 THEN 'Untreated tap water'
+                    WHEN COALESCE(vc.covered_well, 0) = 1 THEN 'Covered well'
+                    WHEN COALESCE(vc.handpump, 0) = 1 THEN 'Hand pump'
+                    WHEN COALESCE(vc.uncovered_well, 0) = 1 THEN 'Uncovered well'
+                    ELSE 'None recorded'
+                END AS water_source,
+                CASE
+                    WHEN vc.village IS NULL THEN ''
+                    WHEN COALESCE(vc.power_supply, 0) = 1 THEN 'Available'
+                    ELSE 'Not available'
+                END AS power_supply,
+                CASE
+                    WHEN vc.village IS NULL THEN ''
+                    WHEN COALESCE(vc.national_highway, 0) = 1 THEN 'National highway'
+                    WHEN COALESCE(vc.state_highway, 0) = 1 THEN 'State highway'
+                    WHEN COALESCE(vc.district_road, 0) = 1 THEN 'District road'
+                    ELSE 'No major road'
+                END AS road_connectivity
+            FROM paged v
+            LEFT JOIN LATERAL (
+                SELECT * FROM village_census c
+                WHERE %[4]s
+                LIMIT 1
+            ) vc ON true
+            %[2]s
+            %[3]s
+        )
+        SELECT name, pin_code, population, area, panchayat, COALESCE(distance, 0), amenities,
+            schools, hospitals, banks, post_offices, water_source, power_supply, road_connectivity,
+            total
+        FROM listed
+        ORDER BY sort_value %[7]s NULLS LAST, name, pin_code, distance`,
+        strings.Join(amenities, ", "),
+        facilityCountJoin("school", "schools"),
+        facilityCountJoin("hospitals", "hospitals"),
+        mandalVillageCensus,
+        mandalVillageSorts[page.Sort], sortCensus, strings.ToUpper(page.Order))
+
+    lat, lon := mandalDetails.BasicInfo.Latitude, mandalDetails.BasicInfo.Longitude
+    rows, err := config.DB.QueryContext(ctx, query, district, subdistrict,
+        lat != 0 && lon != 0, lat, lon, page.Limit, (page.Page-1)*page.Limit)
+    if err != nil {
+        return fmt.Errorf("error querying mandal villages: %v", err)
+    }
+    defer rows.Close()
+
+    villages := make([]Village, 0)
+    for rows.Next() {
+        var v Village
+        if err := rows.Scan(&v.Name, &v.PinCode, &v.Population, &v.Area, &v.Panchayat, &v.Distance,
+            pq.Array(&v.Facilities), &v.Schools, &v.Hospitals, &v.Banks, &v.PostOffices,
+            &v.WaterSource, &v.PowerSupply, &v.RoadConnectivity, &page.Total); err != nil {
+            return fmt.Errorf("error scanning mandal village: %v", err)
+        }
+        if v.Facilities == nil {
+            v.Facilities = []string{}
+        }
+        villages = append(villages, v)
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error reading mandal villages: %v", err)
+    }
+
+    mandalDetails.Villages = villages
+    mandalDetails.VillagesPage = &page
+    return nil
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "village_site/config"
+    "village_site/models"
+)
+
+type censusIndicator struct {
+    Key   string
+    Label string
+    Expr  string // SQL expression evaluated against a village_census row
+}
+
+// censusAmenityColumns are the 0/1 facility flags of village_census that
+// make up the amenity count.
+var censusAmenityColumns = []string{
+    "govt_primary_school", "govt_disabled_school", "govt_engineering_college",
+    "govt_medical_college", "govt_polytechnic", "govt_secondary_school",
+    "govt_senior_secondary", "primary_health_center", "community_health_center",
+    "family_welfare_center", "maternity_child_center", "tb_clinic",
+    "veterinary_hospital", "mobile_health_clinic", "medical_shop",
+    "treated_tap_water", "untreated_water", "covered_well", "uncovered_well",
+    "handpump", "drainage_system", "garbage_collection", "direct_drain_discharge",
+    "mobile_coverage", "internet_cafe", "private_courier", "bus_service",
+    "railway_station", "animal_cart", "national_highway", "state_highway",
+    "district_road", "atm", "commercial_bank", "cooperative_bank",
+    "power_supply", "anganwadi", "birth_death_registration", "newspaper",
+}
+
+// censusNumeric casts a loosely typed census column to float8, treating
+// blanks as zero.
+func censusNumeric(column string) string {
+    return fmt.Sprintf("COALESCE(NULLIF(trim(%s::text), '')::float8, 0)", column)
+}
+
+// censusRate divides two census columns as a percentage, yielding NULL when
+// the denominator is zero so the village drops out of the ranking.
+func censusRate(numerator, denominator string) string {
+    return fmt.Sprintf("(%s * 100.0 / NULLIF(%s, 0))", censusNumeric(numerator), censusNumeric(denominator))
+}
+
+func amenityCountExpr() string {
+    parts := make([]string, len(censusAmenityColumns))
+    for i, column := range censusAmenityColumns {
+        parts[i] = fmt.Sprintf("(COALESCE(%s, 0) = 1)::int", column)
+    }
+    return "(" + strings.Join(parts, " + ") + ")::float8"
+}
+
+// rankingIndicators lists the indicators villages can be ranked by, in the
+// order they are reported on the village details page.
+var rankingIndicators = []censusIndicator{
+    {Key: "literacy", Label: "Literacy rate", Expr: censusRate("total_literacy", "total_population")},
+    {Key: "female_literacy", Label: "Female literacy rate", Expr: censusRate("female_literacy", "female_population")},
+    {Key: "workforce", Label: "Workforce participation rate", Expr: censusRate("working_population", "total_population")},
+    {Key: "population", Label: "Population", Expr: censusNumeric("total_population")},
+    {Key: "irrigated_share", Label: "Irrigated area share", Expr: censusRate("irrigated_area", "total_area")},
+    {Key: "amenities", Label: "Amenity count", Expr: amenityCountExpr()},
+}
+
+func findRankingIndicator(key string) (censusIndicator, bool) {
+    for _, indicator := range rankingIndicators {
+        if indicator.Key == key {
+            return indicator, true
+        }
+    }
+    return censusIndicator{}, false
+}
+
+// rankingQuery ranks every village of a district, optionally narrowed to a
+// subdistrict, by the given indicator. Rank 1 is the highest value; the
+// percentile is the share of villages whose value is at or below this one.
+func rankingQuery(indicator censusIndicator) string {
+    return fmt.Sprintf(`
+        WITH scores AS (
+            SELECT district, subdistrict, village, %s AS value
+            FROM village_census
+            WHERE LOWER(trim(district)) = LOWER(trim($1))
+            AND ($2 = '' OR LOWER(trim(subdistrict)) = LOWER(trim($2)))
+        ),
+        ranked AS (
+            SELECT
+                district,
+                subdistrict,
+                village,
+                value,
+                RANK() OVER (ORDER BY value DESC) AS rank,
+                COUNT(*) OVER () AS total,
+                ROUND((CUME_DIST() OVER (ORDER BY value ASC) * 100)::numeric, 2)::float8 AS percentile
+            FROM scores
+            WHERE value IS NOT NULL
+        )`, indicator.Expr)
+}
+
+// GetVillageRankings ranks the villages of a district or subdistrict by a
+// census indicator
+func GetVillageRankings(w http.ResponseWriter, r *http.Request) {
+    district := strings.TrimSpace(r.URL.Query().Get("district"))
+    subdistrict := strings.TrimSpace(r.URL.Query().Get("subdistrict"))
+    indicatorKey := r.URL.Query().Get("indicator")
+    if indicatorKey == "" {
+        indicatorKey = "literacy"
+    }
+
+    if district == "" {
+        http.Error(w, "District is required", http.StatusBadRequest)
+        return
+    }
+
+    indicator, ok := findRankingIndicator(indicatorKey)
+    if !ok {
+        keys := make([]string, len(rankingIndicators))
+        for i, ind := range rankingIndicators {
+            keys[i] = ind.Key
+        }
+        http.Error(w, "Unknown indicator, expected one of: "+strings.Join(keys, ", "), http.StatusBadRequest)
+        return
+    }
+
+    page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+    if page < 1 {
+        page = 1
+    }
+    limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+    if limit < 1 || limit > 500 {
+        limit = 100
+    }
+
+    // order=asc lists the lowest values first, i.e. the worst ranks
+    rankOrder := "ASC"
+    if strings.EqualFold(r.URL.Query().Get("order"), "asc") {
+        rankOrder = "DESC"
+    }
+
+    query := rankingQuery(indicator) + fmt.Sprintf(`
+        SELECT district, subdistrict, village, value, rank, total, percentile
+        FROM ranked
+        ORDER BY rank %s, village
+        LIMIT $3 OFFSET $4`, rankOrder)
+
+    rows, err := config.DB.Query(query, district, subdistrict, limit, (page-1)*limit)
+    if err != nil {
+        log.Printf("Error ranking villages by %s: %v", indicator.Key, err)
+        http.Error(w, "Error ranking villages", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    villages := make([]models.RankedVillage, 0)
+    for rows.Next() {
+        var v models.RankedVillage
+        if err := rows.Scan(&v.District, &v.Subdistrict, &v.Village, &v.Value, &v.Rank, &v.Total, &v.Percentile); err != nil {
+            log.Printf("Error scanning ranked village: %v", err)
+            continue
+        }
+        villages = append(villages, v)
+    }
+
+    if err := rows.Err(); err != nil {
+        log.Printf("Error iterating ranked villages: %v", err)
+        http.Error(w, "Error ranking villages", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "public, max-age=3600")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "district":    district,
+        "subdistrict": subdistrict,
+        "indicator":   indicator.Key,
+        "label":       indicator.Label,
+        "villages":    villages,
+        "page":        page,
+        "limit":       limit,
+    })
+}
+
+// rankInsertQuery ranks every village_census row within its district by
+// the given indicator, for village_census_ranks
+func rankInsertQuery(indicator censusIndicator) string {
+    return fmt.Sprintf(`
+        INSERT INTO village_census_ranks (district, subdistrict, village, indicator, value, rank, total, percentile)
+        SELECT
+            district,
+            subdistrict,
+            village,
+            '%[1]s',
+            value,
+            RANK() OVER (PARTITION BY district ORDER BY value DESC),
+            COUNT(*) OVER (PARTITION BY district),
+            ROUND((CUME_DIST() OVER (PARTITION BY district ORDER BY value ASC) * 100)::numeric, 2)::float8
+        FROM (
+            SELECT LOWER(trim(district)) AS district, LOWER(trim(subdistrict)) AS subdistrict,
+                LOWER(trim(village)) AS village, %[2]s AS value
+            FROM village_census
+            WHERE district IS NOT NULL AND subdistrict IS NOT NULL AND village IS NOT NULL
+        ) scores
+        WHERE value IS NOT NULL`, indicator.Key, indicator.Expr)
+}
+
+// getVillageRankings reports the district rank of a single village for every
+// ranking indicator, from village_census_ranks. Indicators the village has no
+// value for are omitted.
+func getVillageRankings(district, subdistrict, village string) map[string]models.VillageRank {
+    rankings := make(map[string]models.VillageRank)
+
+    rows, err := config.DB.Query(`
+        SELECT DISTINCT ON (indicator) indicator, value, rank, total, percentile
+        FROM village_census_ranks
+        WHERE district = LOWER(trim($1))
+        AND subdistrict = LOWER(trim($2))
+        AND village = LOWER(trim($3))
+        ORDER BY indicator, rank`, district, subdistrict, village)
+    if err != nil {
+        log.Printf("Error reading ranks of village %s: %v", village, err)
+        return rankings
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var rank models.VillageRank
+        if err := rows.Scan(&rank.Indicator, &rank.Value, &rank.Rank, &rank.Total, &rank.Percentile); err != nil {
+            log.Printf("Error scanning rank of village %s: %v", village, err)
+            continue
+        }
+        if _, ok := findRankingIndicator(rank.Indicator); !ok {
+            continue
+        }
+        rank.Summary = fmt.Sprintf("rank %d of %d in district", rank.Rank, rank.Total)
+        rankings[rank.Indicator] = rank
+    }
+
+    return rankings
+}
@@ -0,0 +1,899 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "village_site/config"
+    "village_site/middleware"
+
+    "github.com/gorilla/mux"
+    "github.com/lib/pq"
+)
+
+const (
+    // maxRepresentativeUpload caps the size and rows of an election results
+    // import
+    maxRepresentativeUploadBytes = 10 << 20
+    maxRepresentativeUploadRows  = 5000
+)
+
+// representativeHouse describes where the mandals and villages tables keep
+// the constituency and representative of one house. The first non-empty
+// column of a list wins.
+type representativeHouse struct {
+    Key                   string
+    ConstituencyColumns   []string
+    RepresentativeColumns []string
+    PartyColumn           string
+    VillageColumn         string
+}
+
+var representativeHouses = []representativeHouse{
+    {
+        Key:                   "assembly",
+        ConstituencyColumns:   []string{"assembly_constituency"},
+        RepresentativeColumns: []string{"current_mla", "assembly_mla"},
+        PartyColumn:           "mla_party",
+        VillageColumn:         "assembly_mla",
+    },
+    {
+        Key:                   "lok_sabha",
+        ConstituencyColumns:   []string{"lok_sabha_constituency", "parliament_constituency"},
+        RepresentativeColumns: []string{"parliament_mp"},
+        VillageColumn:         "parliament_mp",
+    },
+}
+
+// findRepresentativeHouse accepts the house key or a common name for it,
+// such as "vidhan sabha", "mla", "parliament" or "mp"
+func findRepresentativeHouse(name string) (representativeHouse, bool) {
+    key := strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+        return r == ' ' || r == '-' || r == '_'
+    }), "_")
+    switch key {
+    case "vidhan_sabha", "mla", "state_assembly":
+        key = "assembly"
+    case "parliament", "mp", "loksabha":
+        key = "lok_sabha"
+    }
+    for _, h := range representativeHouses {
+        if h.Key == key {
+            return h, true
+        }
+    }
+    return representativeHouse{}, false
+}
+
+// coalesceColumns is the first non-empty trimmed column of alias, or ''
+func coalesceColumns(alias string, columns []string) string {
+    parts := make([]string, 0, len(columns)+1)
+    for _, column := range columns {
+        parts = append(parts, fmt.Sprintf("NULLIF(trim(%s.%s), '')", alias, pq.QuoteIdentifier(column)))
+    }
+    return fmt.Sprintf("COALESCE(%s, '')", strings.Join(append(parts, "''"), ", "))
+}
+
+func (h representativeHouse) constituencySQL(alias string) string {
+    return coalesceColumns(alias, h.ConstituencyColumns)
+}
+
+func (h representativeHouse) representativeSQL(alias string) string {
+    return coalesceColumns(alias, h.RepresentativeColumns)
+}
+
+func (h representativeHouse) partySQL(alias string) string {
+    if h.PartyColumn == "" {
+        return "''"
+    }
+    return coalesceColumns(alias, []string{h.PartyColumn})
+}
+
+// mandalStateSQL is the state of mandal alias, taken from its villages as
+// mandals has no state column
+func mandalStateSQL(alias string) string {
+    return fmt.Sprintf(`COALESCE((
+            SELECT trim(sv.state) FROM villages sv
+            WHERE LOWER(sv.district) = LOWER(%[1]s.district) AND LOWER(sv.subdistrict) = LOWER(%[1]s.subdistrict)
+            AND NULLIF(trim(sv.state), '') IS NOT NULL
+            LIMIT 1
+        ), '')`, alias)
+}
+
+// mandalInStateSQL is a condition that mandal alias lies in the state given
+// by the SQL expression state, or that state is ''
+func mandalInStateSQL(alias, state string) string {
+    return fmt.Sprintf(`(%[2]s = '' OR EXISTS (
+            SELECT 1 FROM villages sv
+            WHERE LOWER(sv.district) = LOWER(%[1]s.district) AND LOWER(sv.subdistrict) = LOWER(%[1]s.subdistrict)
+            AND LOWER(trim(sv.state)) = LOWER(trim(%[2]s))
+        ))`, alias, state)
+}
+
+// constituencyStates returns the states whose mandals name a constituency.
+// Seats of the same name exist in several states, e.g. Aurangabad in Bihar
+// and Maharashtra.
+func constituencyStates(ctx context.Context, q queryer, h representativeHouse, name string) ([]string, error) {
+    rows, err := q.QueryContext(ctx, fmt.Sprintf(`
+        SELECT MIN(state)
+        FROM (
+            SELECT %s AS state
+            FROM mandals m
+            WHERE LOWER(%s) = LOWER(trim($1))
+        ) s
+        GROUP BY LOWER(state)
+        ORDER BY 1`, mandalStateSQL("m"), h.constituencySQL("m")), name)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    states := make([]string, 0)
+    for rows.Next() {
+        var state string
+        if err := rows.Scan(&state); err != nil {
+            return nil, err
+        }
+        if state != "" {
+            states = append(states, state)
+        }
+    }
+    return states, rows.Err()
+}
+
+type RepresentativeTerm struct {
+    House          string `json:"house"`
+    Constituency   string `json:"constituency"`
+    State          string `json:"state,omitempty"`
+    Term           string `json:"term"`
+    TermStart      int    `json:"term_start"`
+    Representative string `json:"representative"`
+    Party          string `json:"party"`
+}
+
+// Seat is the current representative of a constituency. Term is empty when
+// no election results have been imported for it and the representative is
+// taken from the mandals data.
+type Seat struct {
+    House          string               `json:"house"`
+    Constituency   string               `json:"constituency"`
+    State          string               `json:"state,omitempty"`
+    Representative string               `json:"representative"`
+    Party          string               `json:"party"`
+    Term           string               `json:"term,omitempty"`
+    History        []RepresentativeTerm `json:"history"`
+}
+
+// termHistory returns the imported terms of a constituency in a state,
+// newest first. Terms imported without a state are included.
+func termHistory(ctx context.Context, house, constituency, state string) ([]RepresentativeTerm, error) {
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT house, name, state, term, term_start, representative, party
+        FROM representative_terms
+        WHERE house = $1 AND constituency = LOWER(trim($2))
+        AND (state = '' OR LOWER(state) = LOWER(trim($3)))
+        ORDER BY term_start DESC`, house, constituency, state)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    terms := make([]RepresentativeTerm, 0)
+    for rows.Next() {
+        var t RepresentativeTerm
+        if err := rows.Scan(&t.House, &t.Constituency, &t.State, &t.Term, &t.TermStart, &t.Representative, &t.Party); err != nil {
+            return nil, err
+        }
+        terms = append(terms, t)
+    }
+    return terms, rows.Err()
+}
+
+// buildSeat combines the representative recorded in the mandals data with
+// the imported term history; the latest imported term takes precedence
+func buildSeat(ctx context.Context, h representativeHouse, constituency, state, representative, party string) (*Seat, error) {
+    if constituency == "" {
+        return nil, nil
+    }
+    history, err := termHistory(ctx, h.Key, constituency, state)
+    if err != nil {
+        return nil, err
+    }
+    seat := &Seat{
+        House:          h.Key,
+        Constituency:   constituency,
+        State:          state,
+        Representative: representative,
+        Party:          party,
+        History:        history,
+    }
+    if len(history) > 0 {
+        latest := history[0]
+        seat.Representative, seat.Party, seat.Term = latest.Representative, latest.Party, latest.Term
+    }
+    return seat, nil
+}
+
+// constituencyOf finds the constituency a representative holds in a
+// district, from the mandals that record them
+func constituencyOf(ctx context.Context, h representativeHouse, district, representative string) (constituency, party string, err error) {
+    err = config.DB.QueryRowContext(ctx, fmt.Sprintf(`
+        SELECT %s, %s
+        FROM mandals m
+        WHERE LOWER(m.district) = LOWER($1)
+        AND LOWER(%s) = LOWER(trim($2))
+        AND %s <> ''
+        LIMIT 1`, h.constituencySQL("m"), h.partySQL("m"), h.representativeSQL("m"), h.constituencySQL("m")),
+        district, representative).Scan(&constituency, &party)
+    if err == sql.ErrNoRows {
+        return "", "", nil
+    }
+    return constituency, party, err
+}
+
+// GetRepresentatives returns the assembly and Lok Sabha seats of a mandal,
+// or of one of its villages, with the term history of each. A village's own
+// recorded MLA or MP takes precedence where its mandal is split between
+// constituencies.
+func GetRepresentatives(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    district, subdistrict, village := q.Get("district"), q.Get("subdistrict"), q.Get("village")
+    if district == "" || subdistrict == "" {
+        http.Error(w, "District and subdistrict are required", http.StatusBadRequest)
+        return
+    }
+
+    columns := make([]string, 0)
+    for _, h := range representativeHouses {
+        columns = append(columns, h.constituencySQL("m"), h.representativeSQL("m"), h.partySQL("m"))
+    }
+    values := make([]string, len(columns))
+    var state string
+    dest := []interface{}{&district, &subdistrict, &state}
+    for i := range values {
+        dest = append(dest, &values[i])
+    }
+    err := config.DB.QueryRowContext(r.Context(), fmt.Sprintf(`
+        SELECT m.district, m.subdistrict, %s, %s
+        FROM mandals m
+        WHERE LOWER(m.district) = LOWER($1) AND LOWER(m.subdistrict) = LOWER($2)
+        LIMIT 1`, mandalStateSQL("m"), strings.Join(columns, ", ")), district, subdistrict).Scan(dest...)
+    if err == sql.ErrNoRows {
+        http.Error(w, "Mandal not found", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        log.Printf("Error fetching mandal representatives: %v", err)
+        http.Error(w, "Error fetching representatives", http.StatusInternalServerError)
+        return
+    }
+
+    villageReps := make(map[string]string)
+    if village != "" {
+        villageColumns := make([]string, len(representativeHouses))
+        villageValues := make([]string, len(representativeHouses))
+        villageDest := []interface{}{&village}
+        for i, h := range representativeHouses {
+            villageColumns[i] = coalesceColumns("v", []string{h.VillageColumn})
+            villageDest = append(villageDest, &villageValues[i])
+        }
+        err := config.DB.QueryRowContext(r.Context(), fmt.Sprintf(`
+            SELECT COALESCE(v.locality, v.village_name), %s
+            FROM villages v
+            WHERE LOWER(v.district) = LOWER($1) AND LOWER(v.subdistrict) = LOWER($2)
+            AND (LOWER(v.locality) = LOWER($3) OR LOWER(v.village_name) = LOWER($3))
+            LIMIT 1`, strings.Join(villageColumns, ", ")), district, subdistrict, village).Scan(villageDest...)
+        if err == sql.ErrNoRows {
+            http.Error(w, "Village not found", http.StatusNotFound)
+            return
+        }
+        if err != nil {
+            log.Printf("Error fetching village representatives: %v", err)
+            http.Error(w, "Error fetching representatives", http.StatusInternalServerError)
+            return
+        }
+        for i, h := range representativeHouses {
+            villageReps[h.Key] = villageValues[i]
+        }
+    }
+
+    seats := make(map[string]*Seat)
+    for i, h := range representativeHouses {
+        constituency, representative, party := values[3*i], values[3*i+1], values[3*i+2]
+        if rep := villageReps[h.Key]; rep != "" && !strings.EqualFold(rep, representative) {
+            other, otherParty, err := constituencyOf(r.Context(), h, district, rep)
+            if err != nil {
+                log.Printf("Error finding constituency of %s: %v", rep, err)
+            } else if other != "" {
+                constituency, party = other, otherParty
+            }
+            representative = rep
+        }
+
+        seat, err := buildSeat(r.Context(), h, constituency, state, representative, party)
+        if err != nil {
+            log.Printf("Error fetching %s term history: %v", h.Key, err)
+            http.Error(w, "Error fetching representatives", http.StatusInternalServerError)
+            return
+        }
+        seats[h.Key] = seat
+    }
+
+    response := map[string]interface{}{
+        "district":        district,
+        "subdistrict":     subdistrict,
+        "state":           state,
+        "representatives": seats,
+    }
+    if village != "" {
+        response["village"] = village
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(response)
+}
+
+// GetConstituency lists the mandals and villages of a constituency with its
+// current seat. Villages whose own recorded representative differs from
+// their mandal's are left out, as they belong to another constituency. A
+// name used in several states needs state.
+func GetConstituency(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    h, ok := findRepresentativeHouse(vars["house"])
+    if !ok {
+        http.Error(w, "House must be assembly or lok_sabha", http.StatusNotFound)
+        return
+    }
+    name := strings.TrimSpace(vars["name"])
+    state := strings.TrimSpace(r.URL.Query().Get("state"))
+    if state == "" {
+        states, err := constituencyStates(r.Context(), config.DB, h, name)
+        if err != nil {
+            log.Printf("Error fetching constituency states: %v", err)
+            http.Error(w, "Error fetching constituency", http.StatusInternalServerError)
+            return
+        }
+        if len(states) > 1 {
+            http.Error(w, fmt.Sprintf("Constituency %s exists in %s; give state", name, strings.Join(states, ", ")), http.StatusConflict)
+            return
+        }
+        if len(states) == 1 {
+            state = states[0]
+        }
+    }
+    limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+    if limit < 1 || limit > 5000 {
+        limit = 500
+    }
+    offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+    if offset < 0 {
+        offset = 0
+    }
+
+    rows, err := config.DB.QueryContext(r.Context(), fmt.Sprintf(`
+        SELECT DISTINCT m.district, m.subdistrict, %s, %s, %s
+        FROM mandals m
+        WHERE LOWER(%s) = LOWER($1)
+        AND %s
+        ORDER BY m.district, m.subdistrict`,
+        h.constituencySQL("m"), h.representativeSQL("m"), h.partySQL("m"), h.constituencySQL("m"), mandalInStateSQL("m", "$2")), name, state)
+    if err != nil {
+        log.Printf("Error fetching constituency mandals: %v", err)
+        http.Error(w, "Error fetching constituency", http.StatusInternalServerError)
+        return
+    }
+    type constituencyMandal struct {
+        District    string `json:"district"`
+        Subdistrict string `json:"subdistrict"`
+    }
+    mandals := make([]constituencyMandal, 0)
+    var constituency, representative, party string
+    for rows.Next() {
+        var m constituencyMandal
+        var c, rep, p string
+        if err := rows.Scan(&m.District, &m.Subdistrict, &c, &rep, &p); err != nil {
+            rows.Close()
+            log.Printf("Error scanning constituency mandal: %v", err)
+            http.Error(w, "Error fetching constituency", http.StatusInternalServerError)
+            return
+        }
+        if constituency == "" {
+            constituency = c
+        }
+        if representative == "" {
+            representative, party = rep, p
+        }
+        mandals = append(mandals, m)
+    }
+    rows.Close()
+    if len(mandals) == 0 {
+        http.Error(w, "Constituency not found", http.StatusNotFound)
+        return
+    }
+
+    villageColumn := pq.QuoteIdentifier(h.VillageColumn)
+    rows, err = config.DB.QueryContext(r.Context(), fmt.Sprintf(`
+        SELECT v.district, v.subdistrict, COALESCE(v.locality, v.village_name, ''), COUNT(*) OVER ()
+        FROM villages v
+        WHERE ($4 = '' OR LOWER(trim(v.state)) = LOWER($4))
+        AND EXISTS (
+            SELECT 1 FROM mandals m
+            WHERE LOWER(m.district) = LOWER(v.district)
+            AND LOWER(m.subdistrict) = LOWER(v.subdistrict)
+            AND LOWER(%[1]s) = LOWER($1)
+            AND (COALESCE(trim(v.%[3]s), '') = '' OR %[2]s = ''
+                OR LOWER(trim(v.%[3]s)) = LOWER(%[2]s))
+        )
+        ORDER BY 1, 2, 3
+        LIMIT $2 OFFSET $3`, h.constituencySQL("m"), h.representativeSQL("m"), villageColumn), name, limit, offset, state)
+    if err != nil {
+        log.Printf("Error fetching constituency villages: %v", err)
+        http.Error(w, "Error fetching constituency", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    type constituencyVillage struct {
+        District    string `json:"district"`
+        Subdistrict string `json:"subdistrict"`
+        Village     string `json:"village"`
+    }
+    villages := make([]constituencyVillage, 0)
+    total := 0
+    for rows.Next() {
+        var v constituencyVillage
+        if err := rows.Scan(&v.District, &v.Subdistrict, &v.Village, &total); err != nil {
+            log.Printf("Error scanning constituency village: %v", err)
+            continue
+        }
+        villages = append(villages, v)
+    }
+
+    seat, err := buildSeat(r.Context(), h, constituency, state, representative, party)
+    if err != nil {
+        log.Printf("Error fetching %s term history: %v", h.Key, err)
+        http.Error(w, "Error fetching constituency", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "house":          h.Key,
+        "constituency":   constituency,
+        "state":          state,
+        "seat":           seat,
+        "mandals":        mandals,
+        "villages":       villages,
+        "villages_total": total,
+        "limit":          limit,
+        "offset":         offset,
+    })
+}
+
+// GetPartySeats counts the seats each party holds per district. A seat is a
+// constituency with a mandal in the district, so one spanning two districts
+// counts in both. Parties come from the latest imported term of the seat's
+// state (or one imported without a state), or else the mandals data.
+func GetPartySeats(w http.ResponseWriter, r *http.Request) {
+    house := r.URL.Query().Get("house")
+    if house == "" {
+        house = "assembly"
+    }
+    h, ok := findRepresentativeHouse(house)
+    if !ok {
+        http.Error(w, "House must be assembly or lok_sabha", http.StatusBadRequest)
+        return
+    }
+    district := r.URL.Query().Get("district")
+
+    // current maps constituency and lowercased state to the latest party
+    current := make(map[string]string)
+    rows, err := config.DB.QueryContext(r.Context(), `
+        SELECT DISTINCT ON (constituency, LOWER(state)) constituency, LOWER(state), party
+        FROM representative_terms
+        WHERE house = $1
+        ORDER BY constituency, LOWER(state), term_start DESC`, h.Key)
+    if err != nil {
+        log.Printf("Error fetching current terms: %v", err)
+        http.Error(w, "Error counting seats", http.StatusInternalServerError)
+        return
+    }
+    for rows.Next() {
+        var constituency, state, party string
+        if err := rows.Scan(&constituency, &state, &party); err == nil {
+            current[constituency+"\x00"+state] = party
+        }
+    }
+    rows.Close()
+
+    rows, err = config.DB.QueryContext(r.Context(), fmt.Sprintf(`
+        SELECT DISTINCT ON (LOWER(s.state), LOWER(s.district), LOWER(s.constituency)) s.district, s.state, s.constituency, s.party
+        FROM (
+            SELECT m.district, %[3]s AS state, %[1]s AS constituency, %[2]s AS party
+            FROM mandals m
+            WHERE %[1]s <> ''
+            AND ($1 = '' OR LOWER(m.district) = LOWER($1))
+        ) s
+        ORDER BY LOWER(s.state), LOWER(s.district), LOWER(s.constituency), s.party = ''`,
+        h.constituencySQL("m"), h.partySQL("m"), mandalStateSQL("m")), district)
+    if err != nil {
+        log.Printf("Error fetching district seats: %v", err)
+        http.Error(w, "Error counting seats", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    type partySeats struct {
+        Party string `json:"party"`
+        Seats int    `json:"seats"`
+    }
+    type districtSeats struct {
+        District string       `json:"district"`
+        State    string       `json:"state,omitempty"`
+        Seats    int          `json:"seats"`
+        Parties  []partySeats `json:"parties"`
+    }
+    // Districts are keyed by state too, as names such as Aurangabad repeat
+    counts := make(map[string]map[string]int)
+    var districts []districtSeats
+    for rows.Next() {
+        var d, state, constituency, party string
+        if err := rows.Scan(&d, &state, &constituency, &party); err != nil {
+            log.Printf("Error scanning district seat: %v", err)
+            continue
+        }
+        key := strings.ToLower(constituency)
+        if p, ok := current[key+"\x00"+strings.ToLower(state)]; ok {
+            party = p
+        } else if p, ok := current[key+"\x00"]; ok {
+            party = p
+        }
+        if party == "" {
+            party = "Unknown"
+        }
+        districtKey := strings.ToLower(state + "\x00" + d)
+        if counts[districtKey] == nil {
+            counts[districtKey] = make(map[string]int)
+            districts = append(districts, districtSeats{District: d, State: state})
+        }
+        counts[districtKey][party]++
+    }
+
+    result := make([]districtSeats, 0, len(districts))
+    for _, entry := range districts {
+        key := strings.ToLower(entry.State + "\x00" + entry.District)
+        entry.Parties = make([]partySeats, 0, len(counts[key]))
+        for party, seats := range counts[key] {
+            entry.Seats += seats
+            entry.Parties = append(entry.Parties, partySeats{party, seats})
+        }
+        sort.Slice(entry.Parties, func(i, j int) bool {
+            if entry.Parties[i].Seats != entry.Parties[j].Seats {
+                return entry.Parties[i].Seats > entry.Parties[j].Seats
+            }
+            return entry.Parties[i].Party < entry.Parties[j].Party
+        })
+        result = append(result, entry)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "house":     h.Key,
+        "districts": result,
+    })
+}
+
+// RepresentativeTermInput is one election result to import
+type RepresentativeTermInput struct {
+    House          string `json:"house"`
+    State          string `json:"state"`
+    Constituency   string `json:"constituency"`
+    Term           string `json:"term"`
+    Representative string `json:"representative"`
+    Party          string `json:"party"`
+}
+
+var termYear = regexp.MustCompile(`\b(19|20)\d{2}\b`)
+
+// normalize validates an input; the term must contain the year it began,
+// e.g. "2019-2024" or "2023"
+func (in RepresentativeTermInput) normalize() (RepresentativeTerm, error) {
+    h, ok := findRepresentativeHouse(in.House)
+    if !ok {
+        return RepresentativeTerm{}, fmt.Errorf("house must be assembly or lok_sabha")
+    }
+    t := RepresentativeTerm{
+        House:          h.Key,
+        Constituency:   strings.TrimSpace(in.Constituency),
+        State:          strings.TrimSpace(in.State),
+        Term:           strings.TrimSpace(in.Term),
+        Representative: strings.TrimSpace(in.Representative),
+        Party:          strings.TrimSpace(in.Party),
+    }
+    if t.Constituency == "" || t.Representative == "" {
+        return t, fmt.Errorf("constituency and representative are required")
+    }
+    year := termYear.FindString(t.Term)
+    if year == "" {
+        return t, fmt.Errorf("term must contain the year it began")
+    }
+    t.TermStart, _ = strconv.Atoi(year)
+    return t, nil
+}
+
+// ParseRepresentativeTerms reads election results as CSV with a header row
+// (house, state, constituency, term, representative, party; also name,
+// winner, mla, mp and year) or as a JSON array of RepresentativeTermInput
+func ParseRepresentativeTerms(body io.Reader, format string) ([]RepresentativeTermInput, error) {
+    if format == "json" {
+        var inputs []RepresentativeTermInput
+        if err := json.NewDecoder(body).Decode(&inputs); err != nil {
+            return nil, fmt.Errorf("error reading JSON: %v", err)
+        }
+        if len(inputs) > maxRepresentativeUploadRows {
+            return nil, fmt.Errorf("imports are limited to %d rows", maxRepresentativeUploadRows)
+        }
+        return inputs, nil
+    }
+
+    reader := csv.NewReader(body)
+    reader.TrimLeadingSpace = true
+    header, err := reader.Read()
+    if err != nil {
+        return nil, fmt.Errorf("error reading CSV header: %v", err)
+    }
+    columns := make(map[string]int)
+    for i, name := range header {
+        name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+        switch name {
+        case "name", "winner", "mla", "mp":
+            name = "representative"
+        case "year", "election_year":
+            name = "term"
+        }
+        columns[name] = i
+    }
+    for _, required := range []string{"house", "constituency", "term", "representative"} {
+        if _, ok := columns[required]; !ok {
+            return nil, fmt.Errorf("CSV needs a %s column", required)
+        }
+    }
+
+    var inputs []RepresentativeTermInput
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("error reading CSV: %v", err)
+        }
+        if len(inputs) >= maxRepresentativeUploadRows {
+            return nil, fmt.Errorf("imports are limited to %d rows", maxRepresentativeUploadRows)
+        }
+        field := func(name string) string {
+            if i, ok := columns[name]; ok && i < len(record) {
+                return record[i]
+            }
+            return ""
+        }
+        inputs = append(inputs, RepresentativeTermInput{
+            House: field("house"), State: field("state"), Constituency: field("constituency"),
+            Term: field("term"), Representative: field("representative"), Party: field("party"),
+        })
+    }
+    return inputs, nil
+}
+
+type RepresentativeImportRow struct {
+    Row    int                `json:"row"`
+    Action string             `json:"action"`
+    Error  string             `json:"error,omitempty"`
+    Term   RepresentativeTerm `json:"term"`
+    // Current is set when the term is the latest of its constituency, so the
+    // mandals and villages are updated to it
+    Current bool `json:"current"`
+}
+
+type RepresentativeImport struct {
+    DryRun  bool                      `json:"dry_run"`
+    Summary map[string]int            `json:"summary"`
+    Rows    []RepresentativeImportRow `json:"rows"`
+}
+
+// applyCurrentTerm records a constituency's new representative on its
+// mandals and on their villages that named the outgoing one (or nobody).
+// Only the mandals of the term's state are changed; callers must not apply a
+// term without a state to a name used in several states.
+func applyCurrentTerm(ctx context.Context, tx *sql.Tx, t RepresentativeTerm) error {
+    h, _ := findRepresentativeHouse(t.House)
+    villageColumn := pq.QuoteIdentifier(h.VillageColumn)
+    _, err := tx.ExecContext(ctx, fmt.Sprintf(`
+        UPDATE villages v SET %[3]s = $2
+        FROM mandals m
+        WHERE LOWER(m.district) = LOWER(v.district)
+        AND LOWER(m.subdistrict) = LOWER(v.subdistrict)
+        AND LOWER(%[1]s) = LOWER($1)
+        AND ($3 = '' OR LOWER(trim(v.state)) = LOWER($3))
+        AND (COALESCE(trim(v.%[3]s), '') = '' OR LOWER(trim(v.%[3]s)) = LOWER(%[2]s))`,
+        h.constituencySQL("m"), h.representativeSQL("m"), villageColumn), t.Constituency, t.Representative, t.State)
+    if err != nil {
+        return fmt.Errorf("error updating villages of %s: %v", t.Constituency, err)
+    }
+
+    set := make([]string, 0)
+    for _, column := range h.RepresentativeColumns {
+        set = append(set, fmt.Sprintf("%s = $2", pq.QuoteIdentifier(column)))
+    }
+    args := []interface{}{t.Constituency, t.Representative, t.State}
+    if h.PartyColumn != "" {
+        set = append(set, fmt.Sprintf("%s = $4", pq.QuoteIdentifier(h.PartyColumn)))
+        args = append(args, t.Party)
+    }
+    _, err = tx.ExecContext(ctx, fmt.Sprintf(`
+        UPDATE mandals m SET %s
+        WHERE LOWER(%s) = LOWER($1)
+        AND %s`, strings.Join(set, ", "), h.constituencySQL("m"), mandalInStateSQL("m", "$3")), args...)
+    if err != nil {
+        return fmt.Errorf("error updating mandals of %s: %v", t.Constituency, err)
+    }
+    return nil
+}
+
+// ImportRepresentativeTerms inserts or updates the given terms in one
+// transaction. A term that is the latest of its constituency also becomes
+// the representative recorded on its mandals and villages. With dryRun the
+// outcome of every row is reported and nothing is written.
+func ImportRepresentativeTerms(ctx context.Context, inputs []RepresentativeTermInput, source, user string, dryRun bool) (*RepresentativeImport, error) {
+    result := &RepresentativeImport{
+        DryRun:  dryRun,
+        Summary: map[string]int{"insert": 0, "update": 0, "unchanged": 0, "invalid": 0},
+        Rows:    make([]RepresentativeImportRow, len(inputs)),
+    }
+    // latest is the newest term start per constituency, including rows
+    // already seen in this import
+    latest := make(map[string]int)
+
+    err := config.WithTransaction(ctx, func(tx *sql.Tx) error {
+        for i, input := range inputs {
+            row := &result.Rows[i]
+            row.Row = i + 1
+            t, err := input.normalize()
+            row.Term = t
+            if err != nil {
+                row.Action, row.Error = "invalid", err.Error()
+                continue
+            }
+            if t.State == "" {
+                h, _ := findRepresentativeHouse(t.House)
+                states, err := constituencyStates(ctx, tx, h, t.Constituency)
+                if err != nil {
+                    return err
+                }
+                if len(states) > 1 {
+                    row.Action = "invalid"
+                    row.Error = fmt.Sprintf("constituency exists in %s; state is required", strings.Join(states, ", "))
+                    continue
+                }
+            }
+
+            key := t.House + "\x00" + strings.ToLower(t.Constituency) + "\x00" + t.State
+            if _, ok := latest[key]; !ok {
+                var newest int
+                if err := tx.QueryRowContext(ctx, `
+                    SELECT COALESCE(MAX(term_start), 0) FROM representative_terms
+                    WHERE house = $1 AND constituency = LOWER($2) AND state = $3`,
+                    t.House, t.Constituency, t.State).Scan(&newest); err != nil {
+                    return err
+                }
+                latest[key] = newest
+            }
+            if t.TermStart > latest[key] {
+                latest[key] = t.TermStart
+            }
+
+            var representative, party string
+            err = tx.QueryRowContext(ctx, `
+                SELECT representative, party FROM representative_terms
+                WHERE house = $1 AND constituency = LOWER($2) AND state = $3 AND term_start = $4`,
+                t.House, t.Constituency, t.State, t.TermStart).Scan(&representative, &party)
+            switch {
+            case err == sql.ErrNoRows:
+                row.Action = "insert"
+            case err != nil:
+                return err
+            case representative == t.Representative && party == t.Party:
+                row.Action = "unchanged"
+            default:
+                row.Action = "update"
+            }
+            if dryRun || row.Action == "unchanged" {
+                continue
+            }
+
+            _, err = tx.ExecContext(ctx, `
+                INSERT INTO representative_terms
+                    (house, constituency, state, term_start, term, name, representative, party, source, imported_by)
+                VALUES ($1, LOWER($2), $3, $4, $5, $2, $6, $7, $8, $9)
+                ON CONFLICT (house, constituency, state, term_start) DO UPDATE SET
+                    term = EXCLUDED.term, name = EXCLUDED.name, representative = EXCLUDED.representative,
+                    party = EXCLUDED.party, source = EXCLUDED.source, imported_by = EXCLUDED.imported_by,
+                    imported_at = now()`,
+                t.House, t.Constituency, t.State, t.TermStart, t.Term, t.Representative, t.Party, source, user)
+            if err != nil {
+                return fmt.Errorf("row %d: %v", row.Row, err)
+            }
+        }
+
+        // Apply only the newest term of each constituency, once
+        applied := make(map[string]bool)
+        for i := len(result.Rows) - 1; i >= 0; i-- {
+            row := &result.Rows[i]
+            key := row.Term.House + "\x00" + strings.ToLower(row.Term.Constituency) + "\x00" + row.Term.State
+            if row.Action == "invalid" || row.Term.TermStart != latest[key] {
+                continue
+            }
+            row.Current = true
+            if dryRun || applied[key] {
+                continue
+            }
+            applied[key] = true
+            if err := applyCurrentTerm(ctx, tx, row.Term); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    for _, row := range result.Rows {
+        result.Summary[row.Action]++
+    }
+    return result, nil
+}
+
+// ImportRepresentatives imports election results sent as CSV (text/csv) or
+// JSON. source names where they came from (default "upload").
+func ImportRepresentatives(w http.ResponseWriter, r *http.Request) {
+    body := http.MaxBytesReader(w, r.Body, maxRepresentativeUploadBytes)
+    var format string
+    contentType := r.Header.Get("Content-Type")
+    switch {
+    case strings.HasPrefix(contentType, "text/csv"):
+        format = "csv"
+    case strings.Contains(contentType, "json"):
+        format = "json"
+    default:
+        http.Error(w, "Content-Type must be text/csv or application/json", http.StatusUnsupportedMediaType)
+        return
+    }
+    inputs, err := ParseRepresentativeTerms(body, format)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    source := r.URL.Query().Get("source")
+    if source == "" {
+        source = "upload"
+    }
+    result, err := ImportRepresentativeTerms(r.Context(), inputs, source, middleware.AdminUser(r), r.URL.Query().Get("dry_run") == "true")
+    if err != nil {
+        log.Printf("Error importing representatives: %v", err)
+        http.Error(w, "Error importing representatives", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(result)
+}
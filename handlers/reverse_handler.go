@@ -0,0 +1,133 @@
+package handlers
+
+import (
+    "database/sql"
+    "encoding/json"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "village_site/config"
+)
+
+// reverseSearchWindows are the half-widths, in degrees, of the boxes searched
+// for the nearest village, tried in order until one contains a village
+var reverseSearchWindows = []float64{0.05, 0.25, 1.0}
+
+// reverseConfidenceScale is the distance (km) at which confidence falls to 1/e
+const reverseConfidenceScale = 3.0
+
+type ReverseGeocodeResponse struct {
+    Village struct {
+        Locality     string  `json:"locality"`
+        VillageName  string  `json:"village_name"`
+        Subdistrict  string  `json:"subdistrict"`
+        District     string  `json:"district"`
+        State        string  `json:"state"`
+        PinCode      string  `json:"pin_code"`
+        PostOffice   string  `json:"post_office"`
+        ParliamentMP string  `json:"parliament_mp"`
+        AssemblyMLA  string  `json:"assembly_mla"`
+        Latitude     float64 `json:"latitude"`
+        Longitude    float64 `json:"longitude"`
+    } `json:"village"`
+    DistanceKm      float64 `json:"distance_km"`
+    Confidence      float64 `json:"confidence"`
+    ConfidenceLevel string  `json:"confidence_level"`
+}
+
+// reverseConfidence converts the distance to the village centroid into a
+// 0-1 score and a coarse level. Villages are a few km across, so anything
+// within 1.5 km is very likely the right one.
+func reverseConfidence(distanceKm float64) (float64, string) {
+    score := math.Round(math.Exp(-distanceKm/reverseConfidenceScale)*100) / 100
+    switch {
+    case distanceKm <= 1.5:
+        return score, "high"
+    case distanceKm <= 5:
+        return score, "medium"
+    case distanceKm <= 15:
+        return score, "low"
+    default:
+        return score, "very_low"
+    }
+}
+
+// ReverseGeocode finds the village nearest to a coordinate
+func ReverseGeocode(w http.ResponseWriter, r *http.Request) {
+    lat, errLat := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+    lon, errLon := strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
+    if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+        http.Error(w, "Valid lat and lon are required", http.StatusBadRequest)
+        return
+    }
+
+    query := `
+        WITH candidates AS (
+            SELECT
+                COALESCE(locality, village_name, '') AS locality,
+                COALESCE(village_name, '') AS village_name,
+                COALESCE(subdistrict, '') AS subdistrict,
+                COALESCE(district, '') AS district,
+                COALESCE(state, '') AS state,
+                COALESCE(pin_code::text, '') AS pin_code,
+                COALESCE(post_office, '') AS post_office,
+                COALESCE(parliament_mp, '') AS parliament_mp,
+                COALESCE(assembly_mla, '') AS assembly_mla,
+                NULLIF(trim(latitude::text), '')::float8 AS lat,
+                NULLIF(trim(longitude::text), '')::float8 AS lon
+            FROM villages
+            WHERE NULLIF(trim(latitude::text), '') IS NOT NULL
+            AND NULLIF(trim(longitude::text), '') IS NOT NULL
+            AND NULLIF(trim(latitude::text), '')::float8 BETWEEN $1 - $3 AND $1 + $3
+            AND NULLIF(trim(longitude::text), '')::float8 BETWEEN $2 - $3 AND $2 + $3
+        )
+        SELECT
+            locality, village_name, subdistrict, district, state, pin_code,
+            post_office, parliament_mp, assembly_mla, lat, lon,
+            6371 * acos(LEAST(1.0,
+                cos(radians($1)) * cos(radians(lat)) * cos(radians(lon) - radians($2)) +
+                sin(radians($1)) * sin(radians(lat))
+            )) AS distance
+        FROM candidates
+        WHERE lat <> 0 AND lon <> 0
+        ORDER BY distance
+        LIMIT 1`
+
+    var response ReverseGeocodeResponse
+    v := &response.Village
+    var err error
+    for _, window := range reverseSearchWindows {
+        err = config.DB.QueryRowContext(r.Context(), query, lat, lon, window).Scan(
+            &v.Locality, &v.VillageName, &v.Subdistrict, &v.District, &v.State,
+            &v.PinCode, &v.PostOffice, &v.ParliamentMP, &v.AssemblyMLA,
+            &v.Latitude, &v.Longitude, &response.DistanceKm,
+        )
+        if err == sql.ErrNoRows {
+            continue
+        }
+        // A hit near the corner of the box may still have a closer village
+        // just outside it, so only stop once the hit lies within the
+        // inscribed circle.
+        if err != nil || response.DistanceKm <= window*111*math.Cos(lat*math.Pi/180) {
+            break
+        }
+    }
+
+    if err == sql.ErrNoRows {
+        http.Error(w, "No village found near the given coordinates", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        log.Printf("Error reverse geocoding %f, %f: %v", lat, lon, err)
+        http.Error(w, "Error looking up location", http.StatusInternalServerError)
+        return
+    }
+
+    response.DistanceKm = math.Round(response.DistanceKm*100) / 100
+    response.Confidence, response.ConfidenceLevel = reverseConfidence(response.DistanceKm)
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "public, max-age=3600")
+    json.NewEncoder(w).Encode(response)
+}
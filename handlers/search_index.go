@@ -0,0 +1,198 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "village_site/config"
+    "village_site/models"
+    "village_site/utils"
+
+    "github.com/lib/pq"
+)
+
+// placeKinds are the villages columns indexed for native-script search
+var placeKinds = []string{"locality", "subdistrict", "district", "state"}
+
+// minPrefixKeyLength is the shortest phonetic key also matched as a prefix;
+// shorter keys match too many names
+const minPrefixKeyLength = 3
+
+// placeMatches are the Latin names a native-script query resolved to, by kind
+type placeMatches struct {
+    Transliteration string
+    Names           map[string][]string
+}
+
+func (m placeMatches) empty() bool {
+    return len(m.Names) == 0
+}
+
+// RefreshPlaceSearchIndex rebuilds place_search_keys: the phonetic key of
+// every distinct locality, subdistrict, district, state and river name, plus
+// the native-script river translations as exact aliases of their river.
+func RefreshPlaceSearchIndex(ctx context.Context) error {
+    type entry struct{ kind, name, alias string }
+    seen := make(map[entry]bool)
+    var entries []entry
+    add := func(e entry) {
+        if e.name != "" && !seen[e] {
+            seen[e] = true
+            entries = append(entries, e)
+        }
+    }
+
+    for _, kind := range placeKinds {
+        rows, err := config.DB.QueryContext(ctx, fmt.Sprintf(`
+            SELECT DISTINCT trim(%[1]s) FROM villages WHERE NULLIF(trim(%[1]s), '') IS NOT NULL`, kind))
+        if err != nil {
+            return fmt.Errorf("error reading %s names: %v", kind, err)
+        }
+        for rows.Next() {
+            var name string
+            if err := rows.Scan(&name); err != nil {
+                rows.Close()
+                return fmt.Errorf("error reading %s names: %v", kind, err)
+            }
+            add(entry{kind: kind, name: name})
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return fmt.Errorf("error reading %s names: %v", kind, err)
+        }
+    }
+
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT DISTINCT rivers::text FROM villages WHERE NULLIF(trim(rivers::text), '') IS NOT NULL`)
+    if err != nil {
+        return fmt.Errorf("error reading rivers: %v", err)
+    }
+    for rows.Next() {
+        var raw string
+        if err := rows.Scan(&raw); err != nil {
+            rows.Close()
+            return fmt.Errorf("error reading rivers: %v", err)
+        }
+        var rivers []models.River
+        if decodeJSONColumn(raw, &rivers) != nil {
+            continue
+        }
+        fixRiverTranslations(rivers)
+        for _, river := range rivers {
+            name := strings.TrimSpace(river.Name)
+            add(entry{kind: "river", name: name})
+            for _, translation := range river.Translations {
+                if alias := strings.ToLower(strings.TrimSpace(translation)); utils.HasIndicScript(alias) {
+                    add(entry{kind: "river", name: name, alias: alias})
+                }
+            }
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error reading rivers: %v", err)
+    }
+
+    return config.WithTransaction(ctx, func(tx *sql.Tx) error {
+        if _, err := tx.ExecContext(ctx, `DELETE FROM place_search_keys`); err != nil {
+            return fmt.Errorf("error clearing search index: %v", err)
+        }
+
+        stmt, err := tx.PrepareContext(ctx, pq.CopyIn("place_search_keys", "kind", "name", "search_key", "alias"))
+        if err != nil {
+            return fmt.Errorf("error preparing search index copy: %v", err)
+        }
+        for _, e := range entries {
+            key := utils.PhoneticKey(e.name)
+            if e.alias != "" {
+                key = utils.PhoneticKey(e.alias)
+            }
+            var alias interface{}
+            if e.alias != "" {
+                alias = e.alias
+            }
+            if _, err := stmt.ExecContext(ctx, e.kind, e.name, key, alias); err != nil {
+                stmt.Close()
+                return fmt.Errorf("error copying search index: %v", err)
+            }
+        }
+        if _, err := stmt.ExecContext(ctx); err != nil {
+            stmt.Close()
+            return fmt.Errorf("error copying search index: %v", err)
+        }
+        return stmt.Close()
+    })
+}
+
+// resolveNativeQuery looks up the Latin names a Devanagari, Telugu, Kannada
+// or Tamil query may refer to: exact river translations first, then names
+// sharing its phonetic key. Latin queries resolve to nothing.
+func resolveNativeQuery(ctx context.Context, query string) (placeMatches, error) {
+    matches := placeMatches{Names: make(map[string][]string)}
+    query = strings.ToLower(strings.TrimSpace(query))
+    if !utils.HasIndicScript(query) {
+        return matches, nil
+    }
+    matches.Transliteration = utils.Transliterate(query)
+
+    key := utils.PhoneticKey(query)
+    prefix := ""
+    if len(key) >= minPrefixKeyLength {
+        prefix = key + "%"
+    }
+
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT kind, name
+        FROM place_search_keys
+        WHERE alias = $1 OR search_key = $2 OR ($3 <> '' AND search_key LIKE $3)
+        GROUP BY kind, name
+        ORDER BY
+            MIN(CASE WHEN alias = $1 THEN 1 WHEN search_key = $2 THEN 2 ELSE 3 END),
+            abs(length(name) - length($4)),
+            name
+        LIMIT 200`, query, key, prefix, matches.Transliteration)
+    if err != nil {
+        return matches, fmt.Errorf("error resolving native-script query: %v", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var kind, name string
+        if err := rows.Scan(&kind, &name); err != nil {
+            return matches, fmt.Errorf("error resolving native-script query: %v", err)
+        }
+        matches.Names[kind] = append(matches.Names[kind], strings.ToLower(name))
+    }
+    return matches, rows.Err()
+}
+
+// nativeSearchCondition builds the villages filter for resolved names,
+// numbering its parameters from argStart. Villages on a matched river match
+// too; the river must be a whole name (or translation) of their rivers.
+func nativeSearchCondition(matches placeMatches, argStart int) (string, []interface{}) {
+    var conditions []string
+    var args []interface{}
+    for _, kind := range placeKinds {
+        if names := matches.Names[kind]; len(names) > 0 {
+            args = append(args, pq.Array(names))
+            conditions = append(conditions, fmt.Sprintf("LOWER(trim(%s)) = ANY($%d)", kind, argStart+len(args)-1))
+        }
+    }
+    if rivers := matches.Names["river"]; len(rivers) > 0 {
+        // the quoted JSON string matches a whole value, so "ganga" does not
+        // match "ramganga"
+        patterns := make([]string, len(rivers))
+        for i, river := range rivers {
+            name, _ := json.Marshal(river)
+            patterns[i] = "%" + likeEscaper.Replace(string(name)) + "%"
+        }
+        args = append(args, pq.Array(patterns))
+        conditions = append(conditions, fmt.Sprintf("LOWER(rivers::text) LIKE ANY($%d)", argStart+len(args)-1))
+    }
+    if len(conditions) == 0 {
+        return "FALSE", nil
+    }
+    return "(" + strings.Join(conditions, " OR ") + ")", args
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+    "context"
+    "crypto/sha1"
+    "database/sql"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "village_site/config"
+    "village_site/utils"
+
+    "github.com/gorilla/mux"
+    "github.com/lib/pq"
+)
+
+const (
+    tileExtent = 4096
+    // tileGridCells is the number of clustering cells along each tile edge
+    tileGridCells = 64
+    // maxTileFeatures caps the points written to a single tile layer
+    maxTileFeatures = 20000
+    maxTileZoom     = 18
+)
+
+// tileLayer describes how a table is rendered as a vector tile layer. Below
+// MinZoom the layer is empty; below ClusterBelow points are merged into grid
+// cells carrying a count, so low zoom tiles stay small. Points are read from
+// tile_points, which RefreshTilePoints builds from Table. HighwaysColumn, if
+// set, is copied into tile_points for mandal routes.
+type tileLayer struct {
+    Table          string
+    NameColumn     string
+    HighwaysColumn string
+    MinZoom        int
+    ClusterBelow   int
+}
+
+var villageTileLayer = tileLayer{Table: "villages", NameColumn: "locality", HighwaysColumn: "national_highways", MinZoom: 4, ClusterBelow: 12}
+
+func findTileLayer(name string) (tileLayer, bool) {
+    if name == "villages" {
+        return villageTileLayer, true
+    }
+    if facilityType, ok := config.FindFacilityType(name); ok {
+        return tileLayer{Table: facilityType.Table, NameColumn: "title", MinZoom: 8, ClusterBelow: 13}, true
+    }
+    return tileLayer{}, false
+}
+
+// RefreshTilePoints rebuilds tile_points from the villages table and every
+// facility table, casting their text coordinates once so tiles can be cut
+// with an index range scan. Facility tables that do not exist are skipped.
+func RefreshTilePoints(ctx context.Context) error {
+    layers := map[string]tileLayer{"villages": villageTileLayer}
+    for _, t := range config.FacilityTypes() {
+        if layer, ok := findTileLayer(t.Key); ok {
+            layers[t.Key] = layer
+        }
+    }
+
+    return config.WithTransaction(ctx, func(tx *sql.Tx) error {
+        if _, err := tx.ExecContext(ctx, `DELETE FROM tile_points`); err != nil {
+            return fmt.Errorf("error clearing tile points: %v", err)
+        }
+        for name, layer := range layers {
+            var exists bool
+            if err := tx.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, pq.QuoteIdentifier(layer.Table)).Scan(&exists); err != nil {
+                return fmt.Errorf("error checking table %s: %v", layer.Table, err)
+            }
+            if !exists {
+                continue
+            }
+
+            highways := "''"
+            if layer.HighwaysColumn != "" {
+                highways = fmt.Sprintf("COALESCE(%s::text, '')", pq.QuoteIdentifier(layer.HighwaysColumn))
+            }
+            insert := fmt.Sprintf(`
+                INSERT INTO tile_points (layer, lat, lon, name, district, subdistrict, highways)
+                SELECT $1, lat, lon, name, district, subdistrict, highways
+                FROM (
+                    SELECT
+                        NULLIF(trim(latitude::text), '')::float8 AS lat,
+                        NULLIF(trim(longitude::text), '')::float8 AS lon,
+                        COALESCE(%s, '') AS name,
+                        COALESCE(district, '') AS district,
+                        COALESCE(subdistrict, '') AS subdistrict,
+                        %s AS highways
+                    FROM %s
+                    WHERE NULLIF(trim(latitude::text), '') IS NOT NULL
+                    AND NULLIF(trim(longitude::text), '') IS NOT NULL
+                ) p
+                WHERE lat BETWEEN -90 AND 90 AND lon BETWEEN -180 AND 180`,
+                pq.QuoteIdentifier(layer.NameColumn), highways, pq.QuoteIdentifier(layer.Table))
+            if _, err := tx.ExecContext(ctx, insert, name); err != nil {
+                return fmt.Errorf("error building tile points for %s: %v", name, err)
+            }
+        }
+        return nil
+    })
+}
+
+type cachedTile struct {
+    data []byte
+    etag string
+    // truncated is set when the tile held more than maxTileFeatures points
+    truncated bool
+}
+
+var (
+    tileCache     *utils.LRUCache
+    tileCacheOnce sync.Once
+)
+
+func getTileCache() *utils.LRUCache {
+    tileCacheOnce.Do(func() {
+        tileCache = utils.NewLRUCache(
+            config.GetEnvInt("TILE_CACHE_SIZE", 5000),
+            config.GetEnvDuration("TILE_CACHE_TTL", 6*time.Hour),
+        )
+    })
+    return tileCache
+}
+
+// GetVectorTile serves /tiles/{layer}/{z}/{x}/{y}.mvt as a Mapbox Vector Tile
+func GetVectorTile(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    layerName := vars["layer"]
+
+    layer, ok := findTileLayer(layerName)
+    if !ok {
+        http.Error(w, "Unknown tile layer", http.StatusNotFound)
+        return
+    }
+
+    z, errZ := strconv.Atoi(vars["z"])
+    x, errX := strconv.Atoi(vars["x"])
+    y, errY := strconv.Atoi(vars["y"])
+    if errZ != nil || errX != nil || errY != nil || z < 0 || z > maxTileZoom ||
+        x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+        http.Error(w, "Invalid tile coordinates", http.StatusBadRequest)
+        return
+    }
+
+    key := fmt.Sprintf("%s/%d/%d/%d", layerName, z, x, y)
+    cache := getTileCache()
+
+    var tile cachedTile
+    if cached, found := cache.Get(key); found {
+        tile = cached.(cachedTile)
+    } else {
+        data, truncated, err := buildTile(r, layerName, layer, z, x, y)
+        if err != nil {
+            log.Printf("Error building tile %s: %v", key, err)
+            http.Error(w, "Error building tile", http.StatusInternalServerError)
+            return
+        }
+        sum := sha1.Sum(data)
+        tile = cachedTile{data: data, etag: `"` + hex.EncodeToString(sum[:10]) + `"`, truncated: truncated}
+        cache.Set(key, tile)
+    }
+
+    w.Header().Set("ETag", tile.etag)
+    w.Header().Set("Cache-Control", "public, max-age=3600")
+    if tile.truncated {
+        w.Header().Set("X-Tile-Truncated", "true")
+    }
+    if etagMatches(r.Header.Get("If-None-Match"), tile.etag) {
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+    w.Header().Set("Content-Length", strconv.Itoa(len(tile.data)))
+    w.Write(tile.data)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. The header
+// may hold several tags separated by commas, or "*"; weak tags (W/"...")
+// match their strong form.
+func etagMatches(header, etag string) bool {
+    for _, tag := range strings.Split(header, ",") {
+        tag = strings.TrimSpace(tag)
+        if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+            return true
+        }
+    }
+    return false
+}
+
+// buildTile encodes one tile of a layer. Points are read in a fixed order,
+// so a tile holding more than maxTileFeatures points always keeps the same
+// ones; truncated reports that some were left out.
+func buildTile(r *http.Request, name string, layer tileLayer, z, x, y int) (data []byte, truncated bool, err error) {
+    mvtLayer := utils.NewMVTLayer(name, tileExtent)
+    if z < layer.MinZoom {
+        return utils.EncodeMVT(mvtLayer), false, nil
+    }
+
+    minLon, minLat, maxLon, maxLat := utils.TileBounds(z, x, y)
+
+    var query string
+    args := []interface{}{name, minLat, maxLat, minLon, maxLon}
+    if z < layer.ClusterBelow {
+        // Web Mercator tiles span fewer degrees of latitude than longitude,
+        // so the cells are sized separately along each axis
+        query = fmt.Sprintf(`
+            SELECT AVG(lat), AVG(lon), COUNT(*), MIN(name)
+            FROM tile_points
+            WHERE layer = $1
+            AND lat BETWEEN $2 AND $3 AND lon BETWEEN $4 AND $5
+            GROUP BY floor(lon / $6), floor(lat / $7)
+            ORDER BY floor(lon / $6), floor(lat / $7)
+            LIMIT %d`, maxTileFeatures+1)
+        args = append(args, (maxLon-minLon)/tileGridCells, (maxLat-minLat)/tileGridCells)
+    } else {
+        query = fmt.Sprintf(`
+            SELECT lat, lon, 1, name
+            FROM tile_points
+            WHERE layer = $1
+            AND lat BETWEEN $2 AND $3 AND lon BETWEEN $4 AND $5
+            ORDER BY lat, lon, name
+            LIMIT %d`, maxTileFeatures+1)
+    }
+
+    rows, err := config.DB.QueryContext(r.Context(), query, args...)
+    if err != nil {
+        return nil, false, err
+    }
+    defer rows.Close()
+
+    var id uint64
+    for rows.Next() {
+        if id == maxTileFeatures {
+            truncated = true
+            break
+        }
+        var lat, lon float64
+        var count int
+        var pointName string
+        if err := rows.Scan(&lat, &lon, &count, &pointName); err != nil {
+            return nil, false, err
+        }
+
+        px, py := utils.TilePixel(lat, lon, z, x, y, tileExtent)
+        properties := map[string]interface{}{"count": count}
+        if count == 1 {
+            properties["name"] = pointName
+        }
+        id++
+        mvtLayer.AddPoint(id, px, py, properties)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, false, err
+    }
+
+    return utils.EncodeMVT(mvtLayer), truncated, nil
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strconv"
+    "strings"
+    "village_site/config"
+    "village_site/models"
+    "village_site/utils"
+
+    "github.com/lib/pq"
+)
+
+const (
+    defaultTouristPlaceRadiusKm = 50.0
+    maxTouristPlaceRadiusKm     = 300.0
+    defaultTouristPlaceLimit    = 20
+    maxTouristPlaceLimit        = 200
+)
+
+// seasonMonths are the months of the Indian seasons used to read best_time
+// and to filter by season
+var seasonMonths = map[string][]int{
+    "winter":      {12, 1, 2},
+    "spring":      {2, 3},
+    "summer":      {3, 4, 5},
+    "monsoon":     {6, 7, 8, 9},
+    "rainy":       {6, 7, 8, 9},
+    "postmonsoon": {10, 11},
+    "autumn":      {10, 11},
+}
+
+var monthNames = []string{"january", "february", "march", "april", "may", "june",
+    "july", "august", "september", "october", "november", "december"}
+
+// monthAbbreviations are the standard short month names
+var monthAbbreviations = map[string]int{
+    "jan": 1, "feb": 2, "mar": 3, "apr": 4, "jun": 6, "jul": 7,
+    "aug": 8, "sep": 9, "sept": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+// ambiguousMonths are month words that are also common English words; they
+// only count as months next to a month, a range or list word, or "in"
+var ambiguousMonths = map[string]bool{"may": true, "mar": true}
+
+// monthContextWords may stand next to an ambiguous month word
+var monthContextWords = map[string]bool{
+    "to": true, "-": true, "till": true, "until": true, "through": true, "thru": true,
+    "and": true, "or": true, ",": true, "in": true, "from": true, "early": true, "mid": true, "late": true,
+}
+
+var bestTimeTokens = regexp.MustCompile(`[a-z]+|[-,;.]`)
+
+// monthOf returns 1-12 for a full month name or standard abbreviation, or 0
+func monthOf(word string) int {
+    for i, name := range monthNames {
+        if word == name {
+            return i + 1
+        }
+    }
+    return monthAbbreviations[word]
+}
+
+// bestTimeMonths reads the months a best_time text recommends, such as
+// "October to March", "Oct-Feb, July", "Winter" or "All year round". "May"
+// and "Mar" only count as months where they read as one, so "may get
+// crowded" adds nothing.
+func bestTimeMonths(bestTime string) []int {
+    text := strings.ToLower(bestTime)
+    for _, all := range []string{"all year", "year round", "year-round", "throughout the year", "any time", "anytime", "all seasons"} {
+        if strings.Contains(text, all) {
+            return []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+        }
+    }
+    text = strings.NewReplacer("post-monsoon", "postmonsoon", "post monsoon", "postmonsoon").Replace(text)
+
+    tokens := bestTimeTokens.FindAllString(text, -1)
+    isMonth := func(i int) bool {
+        if monthOf(tokens[i]) == 0 {
+            return false
+        }
+        if !ambiguousMonths[tokens[i]] || len(tokens) == 1 {
+            return true
+        }
+        for _, j := range []int{i - 1, i + 1} {
+            if j >= 0 && j < len(tokens) && (monthContextWords[tokens[j]] || (monthOf(tokens[j]) != 0 && !ambiguousMonths[tokens[j]])) {
+                return true
+            }
+        }
+        return false
+    }
+
+    set := make(map[int]bool)
+    previous, ranged := 0, false
+    for i, token := range tokens {
+        if isMonth(i) {
+            month := monthOf(token)
+            if ranged {
+                for m := previous; m != month; m = m%12 + 1 {
+                    set[m] = true
+                }
+            }
+            set[month] = true
+            previous, ranged = month, false
+            continue
+        }
+        if months, ok := seasonMonths[strings.TrimSuffix(token, "s")]; ok {
+            for _, m := range months {
+                set[m] = true
+            }
+            previous, ranged = 0, false
+            continue
+        }
+        switch token {
+        case "to", "-", "till", "until", "through", "thru":
+            ranged = previous != 0
+        case "and", "or", ",", ";", ".":
+            ranged = false
+        }
+    }
+
+    months := make([]int, 0, len(set))
+    for m := 1; m <= 12; m++ {
+        if set[m] {
+            months = append(months, m)
+        }
+    }
+    return months
+}
+
+// RefreshTouristPlaces rebuilds tourist_places from the tourist_places JSON
+// of every mandal. Places have no coordinates of their own and are located
+// at their mandal.
+func RefreshTouristPlaces(ctx context.Context) error {
+    return rebuildMandalList(ctx, mandalList{
+        Table:   "tourist_places",
+        Label:   "tourist places",
+        Columns: []string{"type", "description", "activities", "best_time", "months", "distance"},
+        Decode:  decodeTouristPlaces,
+    })
+}
+
+// decodeTouristPlaces reads a mandal's tourist_places JSON into the values
+// of the tourist_places columns
+func decodeTouristPlaces(raw string) ([]mandalListItem, error) {
+    var places []models.TouristPlace
+    if err := decodeJSONColumn(raw, &places); err != nil {
+        return nil, err
+    }
+    items := make([]mandalListItem, len(places))
+    for i, place := range places {
+        activities := make([]string, 0, len(place.Activities))
+        for _, activity := range place.Activities {
+            if activity = strings.TrimSpace(activity); activity != "" {
+                activities = append(activities, activity)
+            }
+        }
+        months := make([]int64, 0, 12)
+        for _, m := range bestTimeMonths(place.BestTime) {
+            months = append(months, int64(m))
+        }
+        var distance interface{}
+        if place.Distance > 0 {
+            distance = place.Distance
+        }
+        items[i] = mandalListItem{place.Name, []interface{}{strings.TrimSpace(place.Type),
+            strings.TrimSpace(place.Description), pq.Array(activities),
+            strings.TrimSpace(place.BestTime), pq.Array(months), distance}}
+    }
+    return items, nil
+}
+
+// TouristPlaceResult is an indexed tourist place with the mandal it belongs
+// to. Latitude and longitude are the mandal's; DistanceFromMandal is the
+// distance recorded with the place, if any.
+type TouristPlaceResult struct {
+    ID                 int64    `json:"id"`
+    Name               string   `json:"name"`
+    Type               string   `json:"type"`
+    Description        string   `json:"description"`
+    Activities         []string `json:"activities"`
+    BestTime           string   `json:"best_time"`
+    BestMonths         []int    `json:"best_months"`
+    District           string   `json:"district"`
+    Subdistrict        string   `json:"subdistrict"`
+    Latitude           *float64 `json:"latitude"`
+    Longitude          *float64 `json:"longitude"`
+    DistanceFromMandal *float64 `json:"distance_from_mandal,omitempty"`
+    Distance           *float64 `json:"distance,omitempty"`
+}
+
+// touristPlaceFilter narrows tourist places by type, activity, area and the
+// months they are best visited in
+type touristPlaceFilter struct {
+    Type        string
+    Activity    string
+    District    string
+    Subdistrict string
+    Months      []int
+}
+
+// parseTouristPlaceFilter reads type, activity, district, subdistrict and
+// season (winter, summer, monsoon, post-monsoon, ...) or month (1-12 or a
+// name) from the query string
+func parseTouristPlaceFilter(q url.Values) (touristPlaceFilter, error) {
+    f := touristPlaceFilter{
+        Type:        strings.TrimSpace(q.Get("type")),
+        Activity:    strings.TrimSpace(q.Get("activity")),
+        District:    strings.TrimSpace(q.Get("district")),
+        Subdistrict: strings.TrimSpace(q.Get("subdistrict")),
+    }
+    if season := strings.ToLower(strings.TrimSpace(q.Get("season"))); season != "" {
+        months, ok := seasonMonths[strings.NewReplacer("-", "", " ", "", "_", "").Replace(season)]
+        if !ok {
+            return f, fmt.Errorf("unknown season")
+        }
+        f.Months = months
+    }
+    if raw := strings.ToLower(strings.TrimSpace(q.Get("month"))); raw != "" {
+        month, err := strconv.Atoi(raw)
+        if err != nil {
+            month = monthOf(raw)
+        }
+        if month < 1 || month > 12 {
+            return f, fmt.Errorf("month must be 1-12 or a month name")
+        }
+        f.Months = []int{month}
+    }
+    return f, nil
+}
+
+// conditions returns the SQL conditions on tourist_places t for the filter,
+// numbering its parameters from $first
+func (f touristPlaceFilter) conditions(first int) (string, []interface{}) {
+    months := make([]int64, len(f.Months))
+    for i, m := range f.Months {
+        months[i] = int64(m)
+    }
+    condition := fmt.Sprintf(`
+            ($%[1]d = '' OR LOWER(t.type) LIKE '%%' || LOWER($%[1]d) || '%%')
+            AND ($%[2]d = '' OR EXISTS (
+                SELECT 1 FROM unnest(t.activities) a WHERE LOWER(a) LIKE '%%' || LOWER($%[2]d) || '%%'
+            ))
+            AND ($%[3]d = '' OR LOWER(t.district) = LOWER($%[3]d))
+            AND ($%[4]d = '' OR LOWER(t.subdistrict) = LOWER($%[4]d))
+            AND (cardinality($%[5]d::int[]) = 0 OR t.months && $%[5]d::int[])`,
+        first, first+1, first+2, first+3, first+4)
+    return condition, []interface{}{likeEscaper.Replace(f.Type), likeEscaper.Replace(f.Activity), f.District, f.Subdistrict, pq.Array(months)}
+}
+
+const touristPlaceColumns = `t.id, t.name, t.type, t.description, t.activities, t.best_time, t.months,
+            t.district, t.subdistrict, t.latitude, t.longitude, t.distance`
+
+func scanTouristPlace(rows *sql.Rows, extra ...interface{}) (TouristPlaceResult, error) {
+    var p TouristPlaceResult
+    var activities []string
+    var months []int64
+    var lat, lon, distance sql.NullFloat64
+    dest := append([]interface{}{&p.ID, &p.Name, &p.Type, &p.Description, pq.Array(&activities),
+        &p.BestTime, pq.Array(&months), &p.District, &p.Subdistrict, &lat, &lon, &distance}, extra...)
+    if err := rows.Scan(dest...); err != nil {
+        return p, err
+    }
+    p.Activities = append(make([]string, 0, len(activities)), activities...)
+    p.BestMonths = make([]int, len(months))
+    for i, m := range months {
+        p.BestMonths[i] = int(m)
+    }
+    if lat.Valid && lon.Valid {
+        p.Latitude, p.Longitude = &lat.Float64, &lon.Float64
+    }
+    if distance.Valid {
+        p.DistanceFromMandal = &distance.Float64
+    }
+    return p, nil
+}
+
+// SearchTouristPlaces finds tourist places by name (q), type, activity, area
+// and season. Exact and prefix name matches rank first.
+func SearchTouristPlaces(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    filter, err := parseTouristPlaceFilter(q)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    name := utils.NormalizePlaceName(q.Get("q"))
+    if name == "" && filter.Type == "" && filter.Activity == "" && filter.District == "" && len(filter.Months) == 0 {
+        http.Error(w, "A search term or filter is required", http.StatusBadRequest)
+        return
+    }
+    limit := listLimit(q.Get("limit"), defaultTouristPlaceLimit, maxTouristPlaceLimit)
+    offset, _ := strconv.Atoi(q.Get("offset"))
+    if offset < 0 {
+        offset = 0
+    }
+
+    condition, args := filter.conditions(4)
+    rows, err := config.DB.QueryContext(r.Context(), fmt.Sprintf(`
+        SELECT %s, COUNT(*) OVER ()
+        FROM tourist_places t
+        WHERE ($1 = '' OR t.search_key LIKE '%%' || $1 || '%%')
+        AND %s
+        ORDER BY t.search_key = $1 DESC, t.search_key LIKE $1 || '%%' DESC, t.name, t.district, t.subdistrict
+        LIMIT $2 OFFSET $3`, touristPlaceColumns, condition),
+        append([]interface{}{name, limit, offset}, args...)...)
+    if err != nil {
+        log.Printf("Error searching tourist places: %v", err)
+        http.Error(w, "Error searching tourist places", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    places := make([]TouristPlaceResult, 0)
+    total := 0
+    for rows.Next() {
+        place, err := scanTouristPlace(rows, &total)
+        if err != nil {
+            log.Printf("Error scanning tourist place: %v", err)
+            continue
+        }
+        places = append(places, place)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "places": places,
+        "total":  total,
+        "limit":  limit,
+        "offset": offset,
+    })
+}
+
+// GetNearbyTouristPlaces lists tourist places within radius km (default 50)
+// of lat/lon or of a village given by district, subdistrict and village,
+// nearest first. The same filters as the search apply.
+func GetNearbyTouristPlaces(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    filter, err := parseTouristPlaceFilter(q)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    // district and subdistrict locate the village here rather than filter
+    filter.District, filter.Subdistrict = "", ""
+
+    lat, lon, ok := requestPoint(w, r)
+    if !ok {
+        return
+    }
+
+    radius, ok := requestRadius(w, r, defaultTouristPlaceRadiusKm, maxTouristPlaceRadiusKm)
+    if !ok {
+        return
+    }
+    limit := listLimit(q.Get("limit"), defaultTouristPlaceLimit, maxTouristPlaceLimit)
+
+    condition, args := filter.conditions(7)
+    rows, err := config.DB.QueryContext(r.Context(),
+        nearbyQuery("tourist_places", "t", touristPlaceColumns, condition, "distance_km, name"),
+        append(nearbyArgs(lat, lon, radius, limit), args...)...)
+    if err != nil {
+        log.Printf("Error fetching nearby tourist places: %v", err)
+        http.Error(w, "Error fetching tourist places", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    places := make([]TouristPlaceResult, 0)
+    for rows.Next() {
+        var distance float64
+        place, err := scanTouristPlace(rows, &distance)
+        if err != nil {
+            log.Printf("Error scanning tourist place: %v", err)
+            continue
+        }
+        distance = math.Round(distance*100) / 100
+        place.Distance = &distance
+        places = append(places, place)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "latitude":  lat,
+        "longitude": lon,
+        "radius":    radius,
+        "places":    places,
+    })
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestBestTimeMonths(t *testing.T) {
+    tests := []struct {
+        bestTime string
+        want     []int
+    }{
+        {"October to March", []int{1, 2, 3, 10, 11, 12}},
+        {"Oct-Feb", []int{1, 2, 10, 11, 12}},
+        {"Oct-Feb, July", []int{1, 2, 7, 10, 11, 12}},
+        {"Winter", []int{1, 2, 12}},
+        {"All year", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+        {"All year round", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+        {"Post-monsoon", []int{10, 11}},
+        {"Sept to Nov", []int{9, 10, 11}},
+        {"March to May", []int{3, 4, 5}},
+        {"Mar-May", []int{3, 4, 5}},
+        {"May", []int{5}},
+        {"Best visited in May", []int{5}},
+        {"June and July; may get crowded on weekends", []int{6, 7}},
+        {"Heavy rains mar the views", []int{}},
+        {"Marvellous in Decemberish weather", []int{}},
+        {"", []int{}},
+    }
+    for _, tt := range tests {
+        if got := bestTimeMonths(tt.bestTime); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("bestTimeMonths(%q) = %v, want %v", tt.bestTime, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+    "context"
+    "log"
+    "time"
+    "village_site/config"
+    "village_site/handlers"
+)
+
+// backgroundJob is a periodic refresh of a precomputed table
+type backgroundJob struct {
+    Name     string
+    Interval time.Duration
+    Run      func(context.Context) error
+}
+
+func backgroundJobs() []backgroundJob {
+    return []backgroundJob{
+        {
+            Name:     "census aggregates",
+            Interval: config.GetEnvDuration("CENSUS_AGGREGATE_REFRESH_INTERVAL", 24*time.Hour),
+            Run:      handlers.RefreshCensusAggregates,
+        },
+        {
+            Name:     "place search index",
+            Interval: config.GetEnvDuration("SEARCH_INDEX_REFRESH_INTERVAL", 24*time.Hour),
+            Run:      handlers.RefreshPlaceSearchIndex,
+        },
+        {
+            Name:     "census links",
+            Interval: config.GetEnvDuration("CENSUS_LINK_REFRESH_INTERVAL", 24*time.Hour),
+            Run:      handlers.RefreshCensusLinks,
+        },
+        {
+            Name:     "facility summary",
+            Interval: config.GetEnvDuration("FACILITY_SUMMARY_REFRESH_INTERVAL", 6*time.Hour),
+            Run:      handlers.RefreshFacilitySummary,
+        },
+        {
+            Name:     "tourist places",
+            Interval: config.GetEnvDuration("TOURIST_PLACES_REFRESH_INTERVAL", 24*time.Hour),
+            Run:      handlers.RefreshTouristPlaces,
+        },
+        {
+            Name:     "companies",
+            Interval: config.GetEnvDuration("COMPANIES_REFRESH_INTERVAL", 24*time.Hour),
+            Run:      handlers.RefreshCompanies,
+        },
+        {
+            Name:     "tile points",
+            Interval: config.GetEnvDuration("TILE_POINTS_REFRESH_INTERVAL", 6*time.Hour),
+            Run:      handlers.RefreshTilePoints,
+        },
+    }
+}
+
+// startBackgroundJobs runs every job once at startup and then on its
+// interval until ctx is cancelled.
+func startBackgroundJobs(ctx context.Context) {
+    for _, job := range backgroundJobs() {
+        go func(job backgroundJob) {
+            ticker := time.NewTicker(job.Interval)
+            defer ticker.Stop()
+
+            for {
+                runJob(ctx, job)
+                select {
+                case <-ctx.Done():
+                    return
+                case <-ticker.C:
+                }
+            }
+        }(job)
+    }
+}
+
+func runJob(ctx context.Context, job backgroundJob) {
+    start := time.Now()
+    if err := job.Run(ctx); err != nil {
+        log.Printf("Background job %s failed: %v", job.Name, err)
+        return
+    }
+    log.Printf("Background job %s finished in %s", job.Name, time.Since(start))
+}
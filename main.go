@@ -7,10 +7,12 @@ import (
     "net/http"
     "os"
     "os/signal"
+    "strings"
     "syscall"
     "time"
     "village_site/config"
     "village_site/handlers"
+    "village_site/middleware"
     "github.com/gorilla/mux"
 )
 
@@ -21,9 +23,26 @@ func main() {
     }
     defer config.CloseDB()
 
+    if err := config.EnsureSchema(); err != nil {
+        log.Fatalf("Failed to prepare database schema: %v", err)
+    }
+
+    // Run a maintenance command instead of the server
+    if len(os.Args) > 1 {
+        if err := runCommand(os.Args[1:]); err != nil {
+            log.Fatalf("Command %s failed: %v", os.Args[1], err)
+        }
+        return
+    }
+
     // Initialize cache
     config.InitCache()
 
+    // Start refreshing precomputed aggregates
+    jobsCtx, stopJobs := context.WithCancel(context.Background())
+    defer stopJobs()
+    startBackgroundJobs(jobsCtx)
+
     // Create router and set up middleware
     router := mux.NewRouter()
     router.Use(corsMiddleware)
@@ -32,6 +51,9 @@ func main() {
     // Health check endpoint
     router.HandleFunc("/health", healthCheck).Methods("GET")
 
+    // Vector tiles
+    router.HandleFunc("/tiles/{layer}/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}.mvt", handlers.GetVectorTile).Methods("GET")
+
     // API routes
     apiRouter := router.PathPrefix("/api/v1").Subrouter()
 
@@ -43,6 +65,8 @@ func main() {
     villageRouter.HandleFunc("/nearby", handlers.GetNearbyVillages).Methods("GET")
     villageRouter.HandleFunc("/stats", handlers.GetVillageStats).Methods("GET")
     villageRouter.HandleFunc("/states", handlers.GetStates).Methods("GET")
+    villageRouter.HandleFunc("/rankings", handlers.GetVillageRankings).Methods("GET")
+    villageRouter.HandleFunc("/export", handlers.ExportVillages).Methods("GET")
 
     // Bank routes
     bankRouter := apiRouter.PathPrefix("/bank").Subrouter()
@@ -58,6 +82,74 @@ func main() {
     pincodeRouter.HandleFunc("/post-office", handlers.GetPostOffices).Methods("GET")
     pincodeRouter.HandleFunc("/stats", handlers.GetPinCodeStats).Methods("GET")
 
+    // Mandal routes
+    mandalRouter := apiRouter.PathPrefix("/mandal").Subrouter()
+    mandalRouter.HandleFunc("/details", handlers.GetMandalDetails).Methods("POST")
+    mandalRouter.HandleFunc("/distance", handlers.GetMandalDistance).Methods("POST")
+    mandalRouter.HandleFunc("/distance-matrix", handlers.GetMandalDistanceMatrix).Methods("POST")
+    mandalRouter.HandleFunc("/districts", handlers.GetDistrictSuggestions).Methods("GET")
+    mandalRouter.HandleFunc("/subdistricts", handlers.GetSubdistrictSuggestions).Methods("GET")
+
+    // Facility routes
+    facilityRouter := apiRouter.PathPrefix("/facilities").Subrouter()
+    facilityRouter.HandleFunc("/types", handlers.GetFacilityTypes).Methods("GET")
+    facilityRouter.HandleFunc("/nearby", handlers.GetNearbyFacilities).Methods("GET")
+    facilityRouter.HandleFunc("/search", handlers.SearchFacilities).Methods("GET")
+    facilityRouter.HandleFunc("/summary/{level:districts|subdistricts}", handlers.GetFacilitySummary).Methods("GET")
+
+    // Reverse geocoding
+    apiRouter.HandleFunc("/reverse", handlers.ReverseGeocode).Methods("GET")
+
+    // GeoJSON routes
+    geoRouter := apiRouter.PathPrefix("/geo").Subrouter()
+    geoRouter.HandleFunc("/villages", handlers.GetVillagesGeoJSON).Methods("GET")
+    geoRouter.HandleFunc("/facilities", handlers.GetFacilitiesGeoJSON).Methods("GET")
+
+    // Census routes
+    apiRouter.HandleFunc("/census", handlers.GetCensusDetails).Methods("POST")
+
+    // Representative routes
+    apiRouter.HandleFunc("/representatives", handlers.GetRepresentatives).Methods("GET")
+    apiRouter.HandleFunc("/representatives/party-seats", handlers.GetPartySeats).Methods("GET")
+    apiRouter.HandleFunc("/constituencies/{house}/{name}", handlers.GetConstituency).Methods("GET")
+
+    // Tourist place routes
+    touristRouter := apiRouter.PathPrefix("/tourist-places").Subrouter()
+    touristRouter.HandleFunc("/search", handlers.SearchTouristPlaces).Methods("GET")
+    touristRouter.HandleFunc("/nearby", handlers.GetNearbyTouristPlaces).Methods("GET")
+
+    // Company routes
+    companyRouter := apiRouter.PathPrefix("/companies").Subrouter()
+    companyRouter.HandleFunc("", handlers.ListCompanies).Methods("GET")
+    companyRouter.HandleFunc("/stats", handlers.GetCompanyStats).Methods("GET")
+    companyRouter.HandleFunc("/nearby", handlers.GetNearbyEmployers).Methods("GET")
+
+    // STD and RTO code routes
+    apiRouter.HandleFunc("/codes", handlers.GetAreaCodes).Methods("GET")
+    apiRouter.HandleFunc("/codes/{kind}/{code}", handlers.GetCodeAreas).Methods("GET")
+
+    // Admin routes
+    adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+    adminRouter.Use(middleware.AdminAuth)
+    adminRouter.HandleFunc("/villages/validate-json", handlers.ValidateVillageJSONHandler).Methods("GET", "POST")
+    adminRouter.HandleFunc("/data-quality", handlers.GetDataQualityReport).Methods("GET")
+    adminRouter.HandleFunc("/data-quality/rows", handlers.GetDataQualityRows).Methods("GET")
+    adminRouter.HandleFunc("/census-links", handlers.GetCensusLinks).Methods("GET")
+    adminRouter.HandleFunc("/census-links", handlers.UpdateCensusLink).Methods("PUT")
+    adminRouter.HandleFunc("/facilities/audit", handlers.GetFacilityAuditLog).Methods("GET")
+    // Facility editing needs the id column added by migrate-facility-ids
+    if missing, err := config.MissingFacilityIDs(context.Background()); err != nil {
+        log.Printf("Facility editing disabled: %v", err)
+    } else if len(missing) > 0 {
+        log.Printf("Facility editing disabled until migrate-facility-ids is run; tables without an id column: %s", strings.Join(missing, ", "))
+    } else {
+        adminRouter.HandleFunc("/facilities/{type}", handlers.CreateFacility).Methods("POST")
+        adminRouter.HandleFunc("/facilities/{type}/bulk", handlers.UploadFacilities).Methods("POST")
+        adminRouter.HandleFunc("/facilities/{type}/{id:[0-9]+}", handlers.UpdateFacility).Methods("PUT")
+        adminRouter.HandleFunc("/facilities/{type}/{id:[0-9]+}", handlers.DeleteFacility).Methods("DELETE")
+    }
+    adminRouter.HandleFunc("/representatives/import", handlers.ImportRepresentatives).Methods("POST")
+
     // Start server
     port := os.Getenv("PORT")
     if port == "" {
@@ -86,6 +178,7 @@ func main() {
     <-quit
 
     log.Println("Server shutting down...")
+    stopJobs()
     ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
     defer cancel()
 
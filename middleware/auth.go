@@ -0,0 +1,64 @@
+package middleware
+
+import (
+    "context"
+    "crypto/subtle"
+    "encoding/json"
+    "net/http"
+    "os"
+    "strings"
+)
+
+type contextKey string
+
+const adminUserKey contextKey = "admin_user"
+
+// adminKeys parses ADMIN_API_KEYS, a comma separated list of name:token
+// pairs. The name identifies who made a change in audit records.
+func adminKeys() map[string]string {
+    keys := make(map[string]string)
+    for _, pair := range strings.Split(os.Getenv("ADMIN_API_KEYS"), ",") {
+        parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+        if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+            keys[parts[1]] = parts[0]
+        }
+    }
+    return keys
+}
+
+// AdminAuth only lets requests through that carry an ADMIN_API_KEYS token as
+// "Authorization: Bearer <token>"
+func AdminAuth(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+
+        user := ""
+        if token != "" {
+            for key, name := range adminKeys() {
+                if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+                    user = name
+                    break
+                }
+            }
+        }
+
+        if user == "" {
+            w.Header().Set("Content-Type", "application/json")
+            w.Header().Set("WWW-Authenticate", "Bearer")
+            w.WriteHeader(http.StatusUnauthorized)
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "error":  "Unauthorized",
+                "status": http.StatusUnauthorized,
+            })
+            return
+        }
+
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminUserKey, user)))
+    })
+}
+
+// AdminUser returns the name of the authenticated admin, if any
+func AdminUser(r *http.Request) string {
+    user, _ := r.Context().Value(adminUserKey).(string)
+    return user
+}
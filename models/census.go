@@ -72,15 +72,44 @@ type CensusData struct {
 }
 
 type CensusStatistics struct {
-    Data            CensusData `json:"census_data"`
-    Statistics      struct {
-        LiteracyRate        float64 `json:"literacy_rate"`
-        WorkForceRate       float64 `json:"workforce_rate"`
-        FemaleWorkForceRate float64 `json:"female_workforce_rate"`
-        InfrastructureIndex float64 `json:"infrastructure_index"`
-    } `json:"statistics"`
-    Comparisons     struct {
-        DistrictAvg    map[string]float64 `json:"district_averages"`
-        StateAvg       map[string]float64 `json:"state_averages"`
-    } `json:"comparisons"`
-}
\ No newline at end of file
+    Data            CensusData        `json:"census_data"`
+    Statistics      CensusIndicators  `json:"statistics"`
+    Comparisons     CensusComparisons `json:"comparisons"`
+}
+
+// CensusIndicators are the rates derived from a village's census counts.
+// FemaleWorkForceRate is nil when the census import has no female workers.
+type CensusIndicators struct {
+    LiteracyRate        float64  `json:"literacy_rate"`
+    WorkForceRate       float64  `json:"workforce_rate"`
+    FemaleWorkForceRate *float64 `json:"female_workforce_rate"`
+    InfrastructureIndex float64  `json:"infrastructure_index"`
+}
+
+// CensusComparisons holds the average of each indicator over the villages of
+// the district and state, keyed by the indicator's JSON name.
+type CensusComparisons struct {
+    DistrictAvg    map[string]float64 `json:"district_averages"`
+    StateAvg       map[string]float64 `json:"state_averages"`
+}
+
+// VillageRank describes where a village stands among the villages of its
+// district (or subdistrict) for a single census indicator.
+type VillageRank struct {
+    Indicator  string  `json:"indicator"`
+    Value      float64 `json:"value"`
+    Rank       int     `json:"rank"`
+    Total      int     `json:"total"`
+    Percentile float64 `json:"percentile"`
+    Summary    string  `json:"summary"`
+}
+
+type RankedVillage struct {
+    District    string  `json:"district"`
+    Subdistrict string  `json:"subdistrict"`
+    Village     string  `json:"village"`
+    Value       float64 `json:"value"`
+    Rank        int     `json:"rank"`
+    Total       int     `json:"total"`
+    Percentile  float64 `json:"percentile"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// FacilityType describes one category of points of interest and the table
+// it is stored in
+type FacilityType struct {
+    Key         string `json:"key"`
+    Table       string `json:"table"`
+    DisplayName string `json:"display_name"`
+    Icon        string `json:"icon"`
+    // ResponseKey is the field the category appears under in village
+    // details; MandalKey, if set, overrides it in mandal details
+    ResponseKey string `json:"response_key"`
+    MandalKey   string `json:"mandal_key,omitempty"`
+}
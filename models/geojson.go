@@ -0,0 +1,31 @@
+package models
+
+type FeatureCollection struct {
+    Type      string    `json:"type"`
+    Features  []Feature `json:"features"`
+    Truncated bool      `json:"truncated"`
+    Limit     int       `json:"limit"`
+}
+
+type Feature struct {
+    Type       string                 `json:"type"`
+    Geometry   PointGeometry          `json:"geometry"`
+    Properties map[string]interface{} `json:"properties"`
+}
+
+// PointGeometry is a GeoJSON Point; coordinates are [longitude, latitude]
+type PointGeometry struct {
+    Type        string    `json:"type"`
+    Coordinates []float64 `json:"coordinates"`
+}
+
+func NewPointFeature(lat, lon float64, properties map[string]interface{}) Feature {
+    return Feature{
+        Type: "Feature",
+        Geometry: PointGeometry{
+            Type:        "Point",
+            Coordinates: []float64{lon, lat},
+        },
+        Properties: properties,
+    }
+}
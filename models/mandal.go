@@ -1,5 +1,7 @@
 package models
 
+import "encoding/json"
+
 type Mandal struct {
     ID             string   `json:"id" bson:"_id"`
     Name           string   `json:"name" bson:"name"`
@@ -127,4 +129,52 @@ type Bank struct {
     Address  string `json:"address" bson:"address"`
     Type     string `json:"type" bson:"type"`
     Services []string `json:"services,omitempty" bson:"services,omitempty"`
-}
\ No newline at end of file
+}
+
+// The mandals JSON columns hold either objects or plain strings; a string
+// is taken as the code or name
+
+func (p *Pincode) UnmarshalJSON(data []byte) error {
+    type plain Pincode
+    if s, ok := jsonString(data); ok {
+        *p = Pincode{Code: s}
+        return nil
+    }
+    return json.Unmarshal(data, (*plain)(p))
+}
+
+func (c *College) UnmarshalJSON(data []byte) error {
+    type plain College
+    if s, ok := jsonString(data); ok {
+        *c = College{Name: s}
+        return nil
+    }
+    return json.Unmarshal(data, (*plain)(c))
+}
+
+func (t *TouristPlace) UnmarshalJSON(data []byte) error {
+    type plain TouristPlace
+    if s, ok := jsonString(data); ok {
+        *t = TouristPlace{Name: s}
+        return nil
+    }
+    return json.Unmarshal(data, (*plain)(t))
+}
+
+func (c *Company) UnmarshalJSON(data []byte) error {
+    type plain Company
+    if s, ok := jsonString(data); ok {
+        *c = Company{Name: s}
+        return nil
+    }
+    return json.Unmarshal(data, (*plain)(c))
+}
+
+// jsonString reports whether data is a JSON string, and its value
+func jsonString(data []byte) (string, bool) {
+    var s string
+    if err := json.Unmarshal(data, &s); err != nil {
+        return "", false
+    }
+    return s, true
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+    "strings"
+    "unicode"
+)
+
+// Levenshtein returns the edit distance between a and b, counted in runes
+func Levenshtein(a, b string) int {
+    ra, rb := []rune(a), []rune(b)
+    if len(ra) == 0 {
+        return len(rb)
+    }
+    if len(rb) == 0 {
+        return len(ra)
+    }
+
+    prev := make([]int, len(rb)+1)
+    curr := make([]int, len(rb)+1)
+    for j := range prev {
+        prev[j] = j
+    }
+    for i := 1; i <= len(ra); i++ {
+        curr[0] = i
+        for j := 1; j <= len(rb); j++ {
+            cost := 1
+            if ra[i-1] == rb[j-1] {
+                cost = 0
+            }
+            curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+        }
+        prev, curr = curr, prev
+    }
+    return prev[len(rb)]
+}
+
+// Similarity scores a and b between 0 (nothing in common) and 1 (equal) by
+// edit distance relative to the longer string
+func Similarity(a, b string) float64 {
+    longest := len([]rune(a))
+    if n := len([]rune(b)); n > longest {
+        longest = n
+    }
+    if longest == 0 {
+        return 1
+    }
+    return 1 - float64(Levenshtein(a, b))/float64(longest)
+}
+
+// NormalizePlaceName lowercases a place name and strips punctuation,
+// parenthesised census qualifiers such as "(CT)" or "(Part)" and extra
+// spaces, so that spellings from different datasets can be compared
+func NormalizePlaceName(name string) string {
+    name = strings.ToLower(name)
+    if i := strings.Index(name, "("); i > 0 {
+        name = name[:i]
+    }
+    name = strings.ReplaceAll(name, "&", " and ")
+    name = strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return r
+        }
+        return ' '
+    }, name)
+    return strings.Join(strings.Fields(name), " ")
+}
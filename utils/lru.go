@@ -0,0 +1,80 @@
+package utils
+
+import (
+    "container/list"
+    "sync"
+    "time"
+)
+
+// LRUCache is a size-bounded, concurrency-safe cache that evicts the least
+// recently used entry when full. Entries also expire after ttl.
+type LRUCache struct {
+    mu       sync.Mutex
+    capacity int
+    ttl      time.Duration
+    items    map[string]*list.Element
+    order    *list.List
+}
+
+type lruEntry struct {
+    key       string
+    value     interface{}
+    expiresAt time.Time
+}
+
+func NewLRUCache(capacity int, ttl time.Duration) *LRUCache {
+    if capacity < 1 {
+        capacity = 1
+    }
+    return &LRUCache{
+        capacity: capacity,
+        ttl:      ttl,
+        items:    make(map[string]*list.Element),
+        order:    list.New(),
+    }
+}
+
+func (c *LRUCache) Get(key string) (interface{}, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    elem, ok := c.items[key]
+    if !ok {
+        return nil, false
+    }
+    entry := elem.Value.(*lruEntry)
+    if c.ttl > 0 && time.Now().After(entry.expiresAt) {
+        c.order.Remove(elem)
+        delete(c.items, key)
+        return nil, false
+    }
+    c.order.MoveToFront(elem)
+    return entry.value, true
+}
+
+func (c *LRUCache) Set(key string, value interface{}) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    expiresAt := time.Now().Add(c.ttl)
+    if elem, ok := c.items[key]; ok {
+        entry := elem.Value.(*lruEntry)
+        entry.value = value
+        entry.expiresAt = expiresAt
+        c.order.MoveToFront(elem)
+        return
+    }
+
+    c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+    for c.order.Len() > c.capacity {
+        oldest := c.order.Back()
+        c.order.Remove(oldest)
+        delete(c.items, oldest.Value.(*lruEntry).key)
+    }
+}
+
+func (c *LRUCache) Len() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.order.Len()
+}
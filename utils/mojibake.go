@@ -0,0 +1,50 @@
+package utils
+
+import (
+    "unicode/utf8"
+)
+
+// cp1252Bytes maps the characters Windows-1252 assigns to 0x80-0x9F back to
+// their byte values. UTF-8 text that was decoded as Windows-1252 and encoded
+// again ("à¤—" for "ग") contains these characters.
+var cp1252Bytes = map[rune]byte{
+    '€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+    'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E,
+    '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+    '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// undoDoubleEncoding reverses one round of UTF-8 → Windows-1252 → UTF-8
+// double encoding. ok is false when s cannot be such a string.
+func undoDoubleEncoding(s string) (string, bool) {
+    raw := make([]byte, 0, len(s))
+    for _, r := range s {
+        if b, found := cp1252Bytes[r]; found {
+            raw = append(raw, b)
+            continue
+        }
+        if r > 0xFF {
+            return s, false
+        }
+        raw = append(raw, byte(r))
+    }
+    if !utf8.Valid(raw) {
+        return s, false
+    }
+    return string(raw), true
+}
+
+// FixMojibake repairs text that was UTF-8 encoded twice (or three times),
+// reporting whether anything changed. Plain ASCII and correctly encoded
+// text is returned unchanged.
+func FixMojibake(s string) (string, bool) {
+    fixed := s
+    for i := 0; i < 3; i++ {
+        next, ok := undoDoubleEncoding(fixed)
+        if !ok || next == fixed {
+            break
+        }
+        fixed = next
+    }
+    return fixed, fixed != s
+}
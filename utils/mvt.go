@@ -0,0 +1,212 @@
+package utils
+
+import (
+    "math"
+)
+
+// Minimal Mapbox Vector Tile (v2.1) encoder for point layers. It writes the
+// protobuf wire format directly so no protobuf dependency is needed.
+
+const (
+    mvtCommandMoveTo = 1
+    mvtGeomTypePoint = 1
+)
+
+type mvtFeature struct {
+    id       uint64
+    tags     []uint32
+    geometry []uint32
+}
+
+// MVTLayer collects point features for one layer of a vector tile
+type MVTLayer struct {
+    Name   string
+    Extent uint32
+
+    features   []mvtFeature
+    keys       []string
+    keyIndex   map[string]uint32
+    values     []interface{}
+    valueIndex map[interface{}]uint32
+}
+
+func NewMVTLayer(name string, extent uint32) *MVTLayer {
+    return &MVTLayer{
+        Name:       name,
+        Extent:     extent,
+        keyIndex:   make(map[string]uint32),
+        valueIndex: make(map[interface{}]uint32),
+    }
+}
+
+// Len returns the number of features in the layer
+func (l *MVTLayer) Len() int {
+    return len(l.features)
+}
+
+// AddPoint adds a point at tile coordinates (x, y). Supported property
+// values are string, bool, int, int64 and float64; others are skipped.
+func (l *MVTLayer) AddPoint(id uint64, x, y int, properties map[string]interface{}) {
+    f := mvtFeature{
+        id: id,
+        geometry: []uint32{
+            mvtCommandMoveTo&0x7 | 1<<3,
+            zigzag(int64(x)),
+            zigzag(int64(y)),
+        },
+    }
+
+    for key, value := range properties {
+        switch v := value.(type) {
+        case int:
+            value = int64(v)
+        case string, bool, int64, float64:
+        default:
+            continue
+        }
+        f.tags = append(f.tags, l.key(key), l.value(value))
+    }
+
+    l.features = append(l.features, f)
+}
+
+func (l *MVTLayer) key(k string) uint32 {
+    if i, ok := l.keyIndex[k]; ok {
+        return i
+    }
+    i := uint32(len(l.keys))
+    l.keys = append(l.keys, k)
+    l.keyIndex[k] = i
+    return i
+}
+
+func (l *MVTLayer) value(v interface{}) uint32 {
+    if i, ok := l.valueIndex[v]; ok {
+        return i
+    }
+    i := uint32(len(l.values))
+    l.values = append(l.values, v)
+    l.valueIndex[v] = i
+    return i
+}
+
+// EncodeMVT serialises the layers into a vector tile
+func EncodeMVT(layers ...*MVTLayer) []byte {
+    var tile []byte
+    for _, layer := range layers {
+        tile = appendBytesField(tile, 3, layer.encode())
+    }
+    return tile
+}
+
+func (l *MVTLayer) encode() []byte {
+    var b []byte
+    b = appendVarintField(b, 15, 2)
+    b = appendBytesField(b, 1, []byte(l.Name))
+
+    for _, f := range l.features {
+        var fb []byte
+        if f.id != 0 {
+            fb = appendVarintField(fb, 1, f.id)
+        }
+        if len(f.tags) > 0 {
+            fb = appendBytesField(fb, 2, packUint32(f.tags))
+        }
+        fb = appendVarintField(fb, 3, mvtGeomTypePoint)
+        fb = appendBytesField(fb, 4, packUint32(f.geometry))
+        b = appendBytesField(b, 2, fb)
+    }
+
+    for _, k := range l.keys {
+        b = appendBytesField(b, 3, []byte(k))
+    }
+
+    for _, v := range l.values {
+        var vb []byte
+        switch val := v.(type) {
+        case string:
+            vb = appendBytesField(vb, 1, []byte(val))
+        case float64:
+            vb = appendTag(vb, 3, 1)
+            bits := math.Float64bits(val)
+            for i := 0; i < 8; i++ {
+                vb = append(vb, byte(bits>>(8*i)))
+            }
+        case int64:
+            vb = appendVarintField(vb, 6, uint64(zigzag64(val)))
+        case bool:
+            n := uint64(0)
+            if val {
+                n = 1
+            }
+            vb = appendVarintField(vb, 7, n)
+        }
+        b = appendBytesField(b, 4, vb)
+    }
+
+    b = appendVarintField(b, 5, uint64(l.Extent))
+    return b
+}
+
+func zigzag(n int64) uint32 {
+    return uint32((n << 1) ^ (n >> 63))
+}
+
+func zigzag64(n int64) uint64 {
+    return uint64((n << 1) ^ (n >> 63))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+    for v >= 0x80 {
+        b = append(b, byte(v)|0x80)
+        v >>= 7
+    }
+    return append(b, byte(v))
+}
+
+func appendTag(b []byte, field int, wireType int) []byte {
+    return appendVarint(b, uint64(field<<3|wireType))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+    return appendVarint(appendTag(b, field, 0), v)
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+    b = appendTag(b, field, 2)
+    b = appendVarint(b, uint64(len(data)))
+    return append(b, data...)
+}
+
+func packUint32(values []uint32) []byte {
+    var b []byte
+    for _, v := range values {
+        b = appendVarint(b, uint64(v))
+    }
+    return b
+}
+
+// TileBounds returns the longitude/latitude bounds of a web mercator tile
+func TileBounds(z, x, y int) (minLon, minLat, maxLon, maxLat float64) {
+    n := math.Exp2(float64(z))
+    minLon = float64(x)/n*360 - 180
+    maxLon = float64(x+1)/n*360 - 180
+    maxLat = tileLat(float64(y), n)
+    minLat = tileLat(float64(y+1), n)
+    return
+}
+
+func tileLat(y, n float64) float64 {
+    return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+}
+
+// TilePixel projects a coordinate into the extent-sized grid of tile z/x/y
+func TilePixel(lat, lon float64, z, x, y int, extent uint32) (int, int) {
+    n := math.Exp2(float64(z))
+    latRad := lat * math.Pi / 180
+    worldX := (lon + 180) / 360 * n
+    worldY := (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n
+    px := (worldX - float64(x)) * float64(extent)
+    py := (worldY - float64(y)) * float64(extent)
+    return int(math.Round(px)), int(math.Round(py))
+}
@@ -0,0 +1,248 @@
+package utils
+
+import (
+    "strings"
+)
+
+// The Brahmic script blocks share one layout (inherited from ISCII), so a
+// single table indexed by the offset into the block covers Devanagari,
+// Bengali, Gurmukhi, Gujarati, Odia, Tamil, Telugu, Kannada and Malayalam.
+const (
+    indicFirstBlock = 0x0900
+    indicLastBlock  = 0x0D7F
+    devanagariBlock = 0x0900
+    gujaratiBlock   = 0x0A80
+    teluguBlock     = 0x0C00
+    kannadaBlock    = 0x0C80
+    malayalamBlock  = 0x0D00
+)
+
+// indicVowels are the independent vowels, by offset
+var indicVowels = map[rune]string{
+    0x05: "a", 0x06: "a", 0x07: "i", 0x08: "i", 0x09: "u", 0x0A: "u",
+    0x0B: "ri", 0x0C: "li", 0x0D: "e", 0x0E: "e", 0x0F: "e", 0x10: "ai",
+    0x11: "o", 0x12: "o", 0x13: "o", 0x14: "au", 0x60: "ri", 0x61: "li",
+}
+
+// indicConsonants are the consonants without their inherent vowel, by offset
+var indicConsonants = map[rune]string{
+    0x15: "k", 0x16: "kh", 0x17: "g", 0x18: "gh", 0x19: "ng",
+    0x1A: "ch", 0x1B: "chh", 0x1C: "j", 0x1D: "jh", 0x1E: "ny",
+    0x1F: "t", 0x20: "th", 0x21: "d", 0x22: "dh", 0x23: "n",
+    0x24: "t", 0x25: "th", 0x26: "d", 0x27: "dh", 0x28: "n",
+    0x29: "n", 0x2A: "p", 0x2B: "ph", 0x2C: "b", 0x2D: "bh", 0x2E: "m",
+    0x2F: "y", 0x30: "r", 0x31: "r", 0x32: "l", 0x33: "l", 0x34: "zh",
+    0x35: "v", 0x36: "sh", 0x37: "sh", 0x38: "s", 0x39: "h",
+    0x58: "q", 0x59: "kh", 0x5A: "gh", 0x5B: "z", 0x5C: "r", 0x5D: "rh",
+    0x5E: "f", 0x5F: "y",
+}
+
+// indicVowelSigns are the dependent vowel signs (matras), by offset
+var indicVowelSigns = map[rune]string{
+    0x3E: "a", 0x3F: "i", 0x40: "i", 0x41: "u", 0x42: "u", 0x43: "ri",
+    0x44: "ri", 0x45: "e", 0x46: "e", 0x47: "e", 0x48: "ai", 0x49: "o",
+    0x4A: "o", 0x4B: "o", 0x4C: "au", 0x57: "au", 0x62: "li", 0x63: "li",
+}
+
+const (
+    indicCandrabindu = 0x01
+    indicAnusvara    = 0x02
+    indicVisarga     = 0x03
+    indicNukta       = 0x3C
+    indicVirama      = 0x4D
+)
+
+// HasIndicScript reports whether s contains any Brahmic script letters
+func HasIndicScript(s string) bool {
+    for _, r := range s {
+        if r >= indicFirstBlock && r <= indicLastBlock {
+            return true
+        }
+    }
+    return false
+}
+
+// indicSegment is one sound of a word being transliterated. kind is 'c' for
+// a consonant, 'a' for a consonant's inherent vowel, 'v' for a written vowel,
+// 'm' for an anusvara and '-' for anything else.
+type indicSegment struct {
+    text string
+    kind byte
+}
+
+// Transliterate converts Brahmic script text into a plain Latin spelling
+// close to how place names are romanised in the datasets: vowel length is
+// not marked ("वाराणसी" → "varanasi", "హైదరాబాద్" → "haidarabad"), Hindi and
+// Gujarati drop the inherent vowel where it is not spoken ("रामपुर" →
+// "rampur") and the anusvara becomes "m" before labials and nasals
+// ("కరీంనగర్" → "karimnagar"). Other characters pass through.
+func Transliterate(s string) string {
+    var out strings.Builder
+    var word []indicSegment
+    block := rune(0)
+
+    // dropInherent removes the inherent vowel of the last consonant, which a
+    // vowel sign or virama replaces
+    dropInherent := func() {
+        if n := len(word); n > 0 && word[n-1].kind == 'a' {
+            word = word[:n-1]
+        }
+    }
+
+    for _, r := range s {
+        if r < indicFirstBlock || r > indicLastBlock {
+            out.WriteString(renderIndicWord(word, block))
+            word = word[:0]
+            out.WriteRune(r)
+            continue
+        }
+
+        block = r &^ 0x7F
+        offset := r - block
+
+        switch {
+        case offset == indicVirama:
+            dropInherent()
+        case offset == indicNukta:
+            // keeps the preceding consonant's sound
+        case indicVowelSigns[offset] != "":
+            dropInherent()
+            word = append(word, indicSegment{indicVowelSigns[offset], 'v'})
+        case offset == indicAnusvara:
+            word = append(word, indicSegment{"n", 'm'})
+        case offset == indicCandrabindu:
+            word = append(word, indicSegment{"n", '-'})
+        case offset == indicVisarga:
+            word = append(word, indicSegment{"h", '-'})
+        case indicConsonants[offset] != "":
+            word = append(word, indicSegment{indicConsonants[offset], 'c'}, indicSegment{"a", 'a'})
+        case indicVowels[offset] != "":
+            word = append(word, indicSegment{indicVowels[offset], 'v'})
+        case offset >= 0x66 && offset <= 0x6F:
+            word = append(word, indicSegment{string('0' + offset - 0x66), '-'})
+        }
+    }
+    out.WriteString(renderIndicWord(word, block))
+
+    return out.String()
+}
+
+// renderIndicWord spells out the segments of one word of the given script
+// block
+func renderIndicWord(word []indicSegment, block rune) string {
+    isVowel := func(i int) bool {
+        return i >= 0 && i < len(word) && (word[i].kind == 'v' || word[i].kind == 'a')
+    }
+    isConsonant := func(i int) bool {
+        return i >= 0 && i < len(word) && (word[i].kind == 'c' || word[i].kind == 'm')
+    }
+
+    // North Indian scripts drop the inherent vowel at the end of a word of
+    // more than one syllable (राम is "ram", not "rama"), and inside a word
+    // between a vowel-consonant and a consonant-vowel (रामपुर is "rampur"),
+    // unless that vowel ends the word (वाराणसी stays "varanasi"). Going right
+    // to left, a vowel dropped later in the word no longer counts as the
+    // vowel after the next consonant.
+    dropped := make([]bool, len(word))
+    if block == devanagariBlock || block == gujaratiBlock {
+        syllables := 0
+        for i := range word {
+            if isVowel(i) {
+                syllables++
+            }
+        }
+        for i := len(word) - 1; i >= 0; i-- {
+            if word[i].kind != 'a' {
+                continue
+            }
+            if i == len(word)-1 {
+                dropped[i] = syllables > 1
+                continue
+            }
+            if isConsonant(i-1) && isVowel(i-2) && isConsonant(i+1) && isVowel(i+2) && !dropped[i+2] && i+3 < len(word) {
+                dropped[i] = true
+            }
+        }
+    }
+
+    var out strings.Builder
+    for i, segment := range word {
+        if dropped[i] {
+            continue
+        }
+        if segment.kind == 'm' {
+            out.WriteString(anusvaraSound(word, i, block))
+            continue
+        }
+        out.WriteString(segment.text)
+    }
+    return out.String()
+}
+
+// anusvaraSound is "m" before a labial or nasal consonant (चंपारण is
+// "champaran", కరీంనగర్ is "karimnagar") and, in Telugu, Kannada and
+// Malayalam, at the end of a word (കൊല്ലം is "kollam"). Elsewhere it is "n".
+func anusvaraSound(word []indicSegment, i int, block rune) string {
+    if i+1 == len(word) {
+        if block == teluguBlock || block == kannadaBlock || block == malayalamBlock {
+            return "m"
+        }
+        return "n"
+    }
+    if next := word[i+1]; next.kind == 'c' {
+        switch next.text {
+        case "p", "ph", "b", "bh", "m", "n":
+            return "m"
+        }
+    }
+    return "n"
+}
+
+// PhoneticKey reduces a place name in Latin or Brahmic script to a coarse
+// key that survives the usual differences in romanisation: vowel length and
+// quality, aspiration, doubled letters and word breaks. "Rampur",
+// "Raamapura" and "रामपुर" all become "rmpr".
+func PhoneticKey(s string) string {
+    s = strings.ToLower(Transliterate(s))
+
+    var letters []rune
+    for _, r := range s {
+        if r >= 'a' && r <= 'z' {
+            letters = append(letters, r)
+        }
+    }
+    if len(letters) == 0 {
+        return ""
+    }
+
+    isVowel := func(r rune) bool {
+        return strings.ContainsRune("aeiouy", r)
+    }
+    replacements := map[rune]rune{'z': 'j', 'q': 'k', 'f': 'p', 'v': 'b', 'w': 'b', 'x': 'k'}
+
+    var key []rune
+    for i, r := range letters {
+        if replacement, ok := replacements[r]; ok {
+            r = replacement
+        }
+        switch {
+        case i == 0:
+            // The first letter is kept so that vowel-initial names stay
+            // distinct, but all vowels are folded together
+            if isVowel(r) {
+                r = 'a'
+            }
+        case isVowel(r):
+            continue
+        case r == 'h' && !isVowel(letters[i-1]):
+            // aspiration ("kh", "dh", "sh") is often dropped in romanisation
+            continue
+        }
+        if len(key) > 0 && key[len(key)-1] == r {
+            continue
+        }
+        key = append(key, r)
+    }
+
+    return string(key)
+}
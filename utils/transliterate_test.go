@@ -0,0 +1,59 @@
+package utils
+
+import "testing"
+
+func TestTransliterate(t *testing.T) {
+    tests := []struct {
+        script string
+        in     string
+        want   string
+    }{
+        {"Devanagari", "वाराणसी", "varanasi"},
+        {"Devanagari", "रामपुर", "rampur"},
+        {"Devanagari", "सहारनपुर", "saharanpur"},
+        {"Devanagari", "चंपारण", "champaran"},
+        {"Devanagari", "अमरावती", "amravati"},
+        {"Devanagari", "पश्चिम चंपारण", "pashchim champaran"},
+        {"Gujarati", "અમદાવાદ", "amdavad"},
+        {"Gujarati", "સુરત", "surat"},
+        {"Bengali", "নদিয়া", "nadiya"},
+        {"Gurmukhi", "ਲੁਧਿਆਣਾ", "ludhiana"},
+        {"Odia", "ପୁରୀ", "puri"},
+        {"Telugu", "హైదరాబాద్", "haidarabad"},
+        {"Telugu", "కరీంనగర్", "karimnagar"},
+        {"Telugu", "వరంగల్", "varangal"},
+        {"Kannada", "ಮೈಸೂರು", "maisuru"},
+        {"Kannada", "ಬೆಂಗಳೂರು", "bengaluru"},
+        {"Tamil", "மதுரை", "maturai"},
+        {"Malayalam", "കൊല്ലം", "kollam"},
+        {"Latin", "Rampur 2", "Rampur 2"},
+    }
+    for _, tt := range tests {
+        if got := Transliterate(tt.in); got != tt.want {
+            t.Errorf("%s: Transliterate(%q) = %q, want %q", tt.script, tt.in, got, tt.want)
+        }
+    }
+}
+
+func TestPhoneticKey(t *testing.T) {
+    tests := []struct {
+        native string
+        latin  string
+    }{
+        {"रामपुर", "Rampur"},
+        {"रामपुर", "Raamapura"},
+        {"सहारनपुर", "Saharanpur"},
+        {"अहमदाबाद", "Ahmedabad"},
+        {"गोरखपुर", "Gorakhpur"},
+        {"ਲੁਧਿਆਣਾ", "Ludhiana"},
+        {"కరీంనగర్", "Karimnagar"},
+        {"వరంగల్", "Warangal"},
+        {"ಬೆಂಗಳೂರು", "Bengaluru"},
+        {"കൊല്ലം", "Kollam"},
+    }
+    for _, tt := range tests {
+        if got, want := PhoneticKey(tt.native), PhoneticKey(tt.latin); got != want {
+            t.Errorf("PhoneticKey(%q) = %q, PhoneticKey(%q) = %q", tt.native, got, tt.latin, want)
+        }
+    }
+}